@@ -1,15 +1,82 @@
 package agent
 
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
 type AgentState struct {
 }
 
 type AgentStepInfo struct {
 }
 
-type ActionResult struct {
-}
+type ActionResult = controller.ActionResult
 
 type Agent struct {
+	Task           string
+	Browser        *browser.Browser
+	MessageManager *controller.MessageManager
+	SensitiveData  controller.SensitiveData
+	// tell the model about javascript errors of the page, so it can react to broken pages
+	IncludeConsoleErrors bool
+	Logger               *slog.Logger // the browser's logger by default
+	History              *AgentHistoryList
+	MaxActionsPerStep    int // actions of one model answer, the rest are dropped
+	MaxFailures          int // failed steps in a row before Run gives up
+}
+
+// sensitiveData maps secret names to values, the model only ever sees the names
+func NewAgent(task string, b *browser.Browser, sensitiveData map[string]string) *Agent {
+	a := new(Agent)
+	a.Task = task
+	a.SensitiveData = sensitiveData
+	// the history is saved to files, only the task given to the model is in it
+	a.History = &AgentHistoryList{Task: a.SensitiveData.Redact(task)}
+	a.MaxActionsPerStep = 10
+	a.MaxFailures = 3
+	a.Browser = b
+	a.Logger = b.Logger
+	if a.Logger == nil {
+		a.Logger = controller.DiscardLogger()
+	}
+	a.MessageManager = controller.NewMessageManager(a.SensitiveData)
+	// values are substituted only when the browser types them
+	b.SensitiveData = a.SensitiveData
+	a.MessageManager.AddMessage("user", fmt.Sprintf("Your ultimate task is: %s", task))
+	if len(a.SensitiveData) > 0 {
+		a.MessageManager.AddMessage("user", fmt.Sprintf("Here are placeholders for sensitive data: %s\nTo use them, write %s",
+			strings.Join(a.SensitiveData.Names(), ", "), controller.SecretPlaceholder("the placeholder name")))
+	}
+	return a
+}
+
+// add the current browser state to the history, the text accompanying the screenshot is redacted too
+func (a *Agent) AddStateMessage(state *browser.BrowserState) error {
+	tabs := make([]string, 0, len(state.Tabs))
+	for _, tab := range state.Tabs {
+		tabs = append(tabs, fmt.Sprintf("[%d] %s %s", tab.PageId, tab.Title, tab.Url))
+	}
+	elements, err := a.Browser.SerializeElements(state)
+	if err != nil {
+		return err
+	}
+	content := fmt.Sprintf("Current url: %s\nCurrent title: %s\nAvailable tabs:\n%s\nInteractive elements from current page:\n%s",
+		state.Url, state.Title, strings.Join(tabs, "\n"), elements)
+	if a.IncludeConsoleErrors && len(state.ConsoleErrors) > 0 {
+		errors := make([]string, 0, len(state.ConsoleErrors))
+		for _, m := range state.ConsoleErrors {
+			errors = append(errors, m.String())
+		}
+		content += fmt.Sprintf("\nJavascript errors of the page:\n%s", strings.Join(errors, "\n"))
+	}
+	a.MessageManager.AddMessage("user", content)
+	a.Logger.Debug("state message added", "url", state.Url, "elements", len(state.SelectorMap), "console_errors", len(state.ConsoleErrors))
+	return nil
 }
 
 var palnnerPrompt = `You are a planning agent that helps break down tasks into smaller steps and reason about the current state.
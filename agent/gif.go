@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+)
+
+// 5x7 glyphs of printable ascii from ' ', a byte per column with the top pixel in bit 0
+var fontGlyphs = [95][5]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, {0x00, 0x00, 0x5F, 0x00, 0x00}, {0x00, 0x07, 0x00, 0x07, 0x00}, {0x14, 0x7F, 0x14, 0x7F, 0x14},
+	{0x24, 0x2A, 0x7F, 0x2A, 0x12}, {0x23, 0x13, 0x08, 0x64, 0x62}, {0x36, 0x49, 0x55, 0x22, 0x50}, {0x00, 0x05, 0x03, 0x00, 0x00},
+	{0x00, 0x1C, 0x22, 0x41, 0x00}, {0x00, 0x41, 0x22, 0x1C, 0x00}, {0x08, 0x2A, 0x1C, 0x2A, 0x08}, {0x08, 0x08, 0x3E, 0x08, 0x08},
+	{0x00, 0x50, 0x30, 0x00, 0x00}, {0x08, 0x08, 0x08, 0x08, 0x08}, {0x00, 0x60, 0x60, 0x00, 0x00}, {0x20, 0x10, 0x08, 0x04, 0x02},
+	{0x3E, 0x51, 0x49, 0x45, 0x3E}, {0x00, 0x42, 0x7F, 0x40, 0x00}, {0x42, 0x61, 0x51, 0x49, 0x46}, {0x21, 0x41, 0x45, 0x4B, 0x31},
+	{0x18, 0x14, 0x12, 0x7F, 0x10}, {0x27, 0x45, 0x45, 0x45, 0x39}, {0x3C, 0x4A, 0x49, 0x49, 0x30}, {0x01, 0x71, 0x09, 0x05, 0x03},
+	{0x36, 0x49, 0x49, 0x49, 0x36}, {0x06, 0x49, 0x49, 0x29, 0x1E}, {0x00, 0x36, 0x36, 0x00, 0x00}, {0x00, 0x56, 0x36, 0x00, 0x00},
+	{0x08, 0x14, 0x22, 0x41, 0x00}, {0x14, 0x14, 0x14, 0x14, 0x14}, {0x00, 0x41, 0x22, 0x14, 0x08}, {0x02, 0x01, 0x51, 0x09, 0x06},
+	{0x32, 0x49, 0x79, 0x41, 0x3E}, {0x7E, 0x11, 0x11, 0x11, 0x7E}, {0x7F, 0x49, 0x49, 0x49, 0x36}, {0x3E, 0x41, 0x41, 0x41, 0x22},
+	{0x7F, 0x41, 0x41, 0x22, 0x1C}, {0x7F, 0x49, 0x49, 0x49, 0x41}, {0x7F, 0x09, 0x09, 0x01, 0x01}, {0x3E, 0x41, 0x41, 0x51, 0x32},
+	{0x7F, 0x08, 0x08, 0x08, 0x7F}, {0x00, 0x41, 0x7F, 0x41, 0x00}, {0x20, 0x40, 0x41, 0x3F, 0x01}, {0x7F, 0x08, 0x14, 0x22, 0x41},
+	{0x7F, 0x40, 0x40, 0x40, 0x40}, {0x7F, 0x02, 0x04, 0x02, 0x7F}, {0x7F, 0x04, 0x08, 0x10, 0x7F}, {0x3E, 0x41, 0x41, 0x41, 0x3E},
+	{0x7F, 0x09, 0x09, 0x09, 0x06}, {0x3E, 0x41, 0x51, 0x21, 0x5E}, {0x7F, 0x09, 0x19, 0x29, 0x46}, {0x46, 0x49, 0x49, 0x49, 0x31},
+	{0x01, 0x01, 0x7F, 0x01, 0x01}, {0x3F, 0x40, 0x40, 0x40, 0x3F}, {0x1F, 0x20, 0x40, 0x20, 0x1F}, {0x7F, 0x20, 0x18, 0x20, 0x7F},
+	{0x63, 0x14, 0x08, 0x14, 0x63}, {0x03, 0x04, 0x78, 0x04, 0x03}, {0x61, 0x51, 0x49, 0x45, 0x43}, {0x00, 0x7F, 0x41, 0x41, 0x00},
+	{0x02, 0x04, 0x08, 0x10, 0x20}, {0x00, 0x41, 0x41, 0x7F, 0x00}, {0x04, 0x02, 0x01, 0x02, 0x04}, {0x40, 0x40, 0x40, 0x40, 0x40},
+	{0x00, 0x01, 0x02, 0x04, 0x00}, {0x20, 0x54, 0x54, 0x54, 0x78}, {0x7F, 0x48, 0x44, 0x44, 0x38}, {0x38, 0x44, 0x44, 0x44, 0x20},
+	{0x38, 0x44, 0x44, 0x48, 0x7F}, {0x38, 0x54, 0x54, 0x54, 0x18}, {0x08, 0x7E, 0x09, 0x01, 0x02}, {0x08, 0x54, 0x54, 0x54, 0x3C},
+	{0x7F, 0x08, 0x04, 0x04, 0x78}, {0x00, 0x44, 0x7D, 0x40, 0x00}, {0x20, 0x40, 0x44, 0x3D, 0x00}, {0x00, 0x7F, 0x10, 0x28, 0x44},
+	{0x00, 0x41, 0x7F, 0x40, 0x00}, {0x7C, 0x04, 0x18, 0x04, 0x78}, {0x7C, 0x08, 0x04, 0x04, 0x78}, {0x38, 0x44, 0x44, 0x44, 0x38},
+	{0x7C, 0x14, 0x14, 0x14, 0x08}, {0x08, 0x14, 0x14, 0x18, 0x7C}, {0x7C, 0x08, 0x04, 0x04, 0x08}, {0x48, 0x54, 0x54, 0x54, 0x20},
+	{0x04, 0x3F, 0x44, 0x40, 0x20}, {0x3C, 0x40, 0x40, 0x20, 0x7C}, {0x1C, 0x20, 0x40, 0x20, 0x1C}, {0x3C, 0x40, 0x30, 0x40, 0x3C},
+	{0x44, 0x28, 0x10, 0x28, 0x44}, {0x0C, 0x50, 0x50, 0x50, 0x3C}, {0x44, 0x64, 0x54, 0x4C, 0x44}, {0x00, 0x08, 0x36, 0x41, 0x00},
+	{0x00, 0x00, 0x7F, 0x00, 0x00}, {0x00, 0x41, 0x36, 0x08, 0x00}, {0x08, 0x04, 0x08, 0x10, 0x08},
+}
+
+type GifOptions struct {
+	Width      int           // frame width in pixels, screenshots are scaled to it, 800 when 0
+	FrameDelay time.Duration // how long a step is shown, 3s when 0
+	ShowTask   bool          // a first frame with the task
+}
+
+func DefaultGifOptions() *GifOptions {
+	return &GifOptions{Width: 800, FrameDelay: 3 * time.Second, ShowTask: true}
+}
+
+// render the run as an animated gif, a frame per step with a screenshot, the task and the step's
+// goal written over it. text outside ascii is drawn as '?'
+func (l *AgentHistoryList) WriteGif(w io.Writer, options *GifOptions) error {
+	if options == nil {
+		options = DefaultGifOptions()
+	}
+	width := options.Width
+	if width <= 0 {
+		width = 800
+	}
+	delay := options.FrameDelay
+	if delay <= 0 {
+		delay = 3 * time.Second
+	}
+	// the frame keeps the aspect of the first viewport, 16:10 when unknown
+	height := width * 10 / 16
+	for _, h := range l.History {
+		if h.State != nil && h.State.Viewport.Width > 0 && h.State.Viewport.Height > 0 {
+			height = width * h.State.Viewport.Height / h.State.Viewport.Width
+			break
+		}
+	}
+	textScale := max(1, width/400)
+	frames := make([]*image.RGBA, 0, len(l.History)+1)
+	if options.ShowTask {
+		frame := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(frame, frame.Bounds(), image.NewUniform(color.RGBA{0x20, 0x20, 0x20, 0xFF}), image.Point{}, draw.Src)
+		drawTextBlock(frame, frame.Bounds().Inset(16*textScale), []string{"Task", "", l.Task}, textScale*2)
+		frames = append(frames, frame)
+	}
+	for n, h := range l.History {
+		if h.State == nil || len(h.State.Screenshot) == 0 {
+			continue
+		}
+		step := n + 1
+		if h.Metadata != nil {
+			step = h.Metadata.Step
+		}
+		src, _, err := image.Decode(bytes.NewReader(h.State.Screenshot))
+		if err != nil {
+			return fmt.Errorf("screenshot of step %d: %w", step, err)
+		}
+		frame := viewportFrame(src, h.State.Viewport, width, height)
+		goal := ""
+		if h.ModelOutput != nil {
+			goal = h.ModelOutput.CurrentState.NextGoal
+		}
+		lines := []string{l.Task, fmt.Sprintf("Step %d: %s", step, goal)}
+		drawCaption(frame, lines, textScale)
+		frames = append(frames, frame)
+	}
+	if len(frames) == 0 {
+		return errors.New("the history has no frames")
+	}
+	out := &gif.GIF{}
+	for _, frame := range frames {
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, frame.Bounds(), frame, image.Point{})
+		out.Image = append(out.Image, paletted)
+		out.Delay = append(out.Delay, int(delay/(10*time.Millisecond)))
+	}
+	return gif.EncodeAll(w, out)
+}
+
+func (l *AgentHistoryList) SaveGif(path string, options *GifOptions) error {
+	var buf bytes.Buffer
+	if err := l.WriteGif(&buf, options); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// the part of a full page screenshot the viewport showed, scaled to the frame size.
+// viewport screenshots are used as they are
+func viewportFrame(src image.Image, viewport browser.ViewportInfo, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	scale := float64(width) / float64(bounds.Dx())
+	top := 0
+	if viewport.Width > 0 {
+		// device pixels per css pixel of the screenshot
+		ratio := float64(bounds.Dx()) / float64(viewport.Width)
+		if float64(bounds.Dy()) > float64(viewport.Height)*ratio+1 {
+			top = int(float64(viewport.ScrollY) * ratio)
+		}
+	}
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(frame, frame.Bounds(), image.White, image.Point{}, draw.Src)
+	// nearest neighbour, the gif palette loses more than this anyway
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + top + int(float64(y)/scale)
+		if sy >= bounds.Max.Y {
+			break
+		}
+		for x := 0; x < width; x++ {
+			sx := bounds.Min.X + int(float64(x)/scale)
+			if sx >= bounds.Max.X {
+				break
+			}
+			frame.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return frame
+}
+
+// lines at the bottom of the frame on a dark band
+func drawCaption(frame *image.RGBA, lines []string, scale int) {
+	padding := 8 * scale
+	wrapped := wrapLines(lines, (frame.Bounds().Dx()-2*padding)/(6*scale))
+	bandHeight := len(wrapped)*9*scale + 2*padding
+	band := image.Rect(0, frame.Bounds().Dy()-bandHeight, frame.Bounds().Dx(), frame.Bounds().Dy())
+	draw.Draw(frame, band, image.NewUniform(color.RGBA{0, 0, 0, 0xB0}), image.Point{}, draw.Over)
+	drawTextBlock(frame, band.Inset(padding), lines, scale)
+}
+
+// wrapped lines in white from the top left of the box, what does not fit is cut
+func drawTextBlock(img *image.RGBA, box image.Rectangle, lines []string, scale int) {
+	wrapped := wrapLines(lines, box.Dx()/(6*scale))
+	y := box.Min.Y
+	for _, line := range wrapped {
+		if y+7*scale > box.Max.Y {
+			return
+		}
+		drawText(img, box.Min.X, y, line, scale)
+		y += 9 * scale
+	}
+}
+
+func drawText(img *image.RGBA, x, y int, text string, scale int) {
+	white := image.NewUniform(color.White)
+	for _, r := range text {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		glyph := fontGlyphs[r-' ']
+		for col, bits := range glyph {
+			for row := 0; row < 7; row++ {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				pixel := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, pixel.Intersect(img.Bounds()), white, image.Point{}, draw.Src)
+			}
+		}
+		x += 6 * scale
+	}
+}
+
+// break the lines at spaces to at most columns characters, longer words are split
+func wrapLines(lines []string, columns int) []string {
+	columns = max(1, columns)
+	wrapped := make([]string, 0, len(lines))
+	for _, line := range lines {
+		current := ""
+		for _, word := range strings.Fields(line) {
+			for len([]rune(word)) > columns {
+				if current != "" {
+					wrapped = append(wrapped, current)
+					current = ""
+				}
+				runes := []rune(word)
+				wrapped = append(wrapped, string(runes[:columns]))
+				word = string(runes[columns:])
+			}
+			switch {
+			case current == "":
+				current = word
+			case len([]rune(current))+1+len([]rune(word)) <= columns:
+				current += " " + word
+			default:
+				wrapped = append(wrapped, current)
+				current = word
+			}
+		}
+		wrapped = append(wrapped, current)
+	}
+	return wrapped
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+)
+
+// a png of width x height, red above split and blue below
+func testScreenshot(t *testing.T, width, height, split int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, image.Rect(0, 0, width, split), image.NewUniform(color.RGBA{0xFF, 0, 0, 0xFF}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, split, width, height), image.NewUniform(color.RGBA{0, 0, 0xFF, 0xFF}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testStep(step int, goal string, state *HistoryState) *AgentHistory {
+	return &AgentHistory{
+		State:       state,
+		ModelOutput: &AgentOutput{CurrentState: AgentBrain{NextGoal: goal}},
+		Metadata:    &StepMetadata{Step: step},
+	}
+}
+
+func TestWriteGif(t *testing.T) {
+	viewport := browser.ViewportInfo{Width: 640, Height: 400}
+	scrolled := viewport
+	scrolled.ScrollY = 400
+	history := &AgentHistoryList{
+		Task: "find the price",
+		History: []*AgentHistory{
+			testStep(1, "open the page", &HistoryState{Screenshot: testScreenshot(t, 640, 400, 400), Viewport: viewport}),
+			testStep(2, "no screenshot", &HistoryState{}),
+			testStep(3, "no state", nil),
+			// a full page screenshot, the viewport shows the blue part
+			testStep(4, "scroll down", &HistoryState{Screenshot: testScreenshot(t, 640, 800, 400), Viewport: scrolled}),
+		},
+	}
+	var buf bytes.Buffer
+	if err := history.WriteGif(&buf, &GifOptions{Width: 320, FrameDelay: time.Second, ShowTask: true}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Image) != 3 {
+		t.Fatalf("%d frames, want the task and 2 steps with screenshots", len(out.Image))
+	}
+	for i, frame := range out.Image {
+		if size := frame.Bounds().Size(); size != image.Pt(320, 200) {
+			t.Errorf("frame %d is %v, want the viewport aspect at width 320", i, size)
+		}
+		if out.Delay[i] != 100 {
+			t.Errorf("frame %d delay %d", i, out.Delay[i])
+		}
+	}
+	// above the caption band
+	if r, _, b, _ := out.Image[1].At(10, 10).RGBA(); r < b {
+		t.Error("the first step does not show its screenshot")
+	}
+	if r, _, b, _ := out.Image[2].At(10, 10).RGBA(); b < r {
+		t.Error("the scrolled step does not show the viewport of the full page screenshot")
+	}
+}
+
+func TestWriteGifErrors(t *testing.T) {
+	empty := &AgentHistoryList{Task: "task", History: []*AgentHistory{testStep(1, "", &HistoryState{})}}
+	if err := empty.WriteGif(new(bytes.Buffer), &GifOptions{ShowTask: false}); err == nil {
+		t.Error("a history without frames is written")
+	}
+	broken := &AgentHistoryList{History: []*AgentHistory{testStep(1, "", &HistoryState{Screenshot: []byte("not an image")})}}
+	if err := broken.WriteGif(new(bytes.Buffer), nil); err == nil {
+		t.Error("a broken screenshot is not reported")
+	}
+	// steps without metadata are numbered by their position
+	broken.History = append([]*AgentHistory{{}}, broken.History...)
+	broken.History[1].Metadata = nil
+	if err := broken.WriteGif(new(bytes.Buffer), nil); err == nil || !strings.Contains(err.Error(), "step 2") {
+		t.Errorf("a broken screenshot without metadata: %v", err)
+	}
+}
+
+func TestWriteGifWithoutMetadata(t *testing.T) {
+	step := testStep(1, "open the page", &HistoryState{Screenshot: testScreenshot(t, 64, 40, 40)})
+	step.Metadata = nil
+	history := &AgentHistoryList{Task: "task", History: []*AgentHistory{step}}
+	if err := history.WriteGif(new(bytes.Buffer), &GifOptions{Width: 64}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	tests := []struct {
+		lines   []string
+		columns int
+		want    []string
+	}{
+		{[]string{"one two three"}, 7, []string{"one two", "three"}},
+		{[]string{"abcdefghij"}, 4, []string{"abcd", "efgh", "ij"}},
+		{[]string{"a", "", "b"}, 10, []string{"a", "", "b"}},
+		{[]string{"x"}, 0, []string{"x"}},
+	}
+	for _, tt := range tests {
+		got := wrapLines(tt.lines, tt.columns)
+		if len(got) != len(tt.want) {
+			t.Errorf("wrapLines(%q, %d) = %q, want %q", tt.lines, tt.columns, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("wrapLines(%q, %d) = %q, want %q", tt.lines, tt.columns, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+)
+
+// the model's view of the task in a step
+type AgentBrain struct {
+	EvaluationPreviousGoal string
+	Memory                 string
+	NextGoal               string
+}
+
+// one action the model asked for, params are the registered param type of the action
+type ActionModel struct {
+	Name   string
+	Params any
+}
+
+// what the model answered in a step
+type AgentOutput struct {
+	CurrentState AgentBrain
+	Actions      []*ActionModel
+}
+
+// the part of the browser state kept for a step
+type HistoryState struct {
+	Url        string
+	Title      string
+	Tabs       []*browser.TabInfo
+	Screenshot []byte
+	Viewport   browser.ViewportInfo // scroll position and size of the viewport, zero when unknown
+	// elements the actions of the step used, by the param field that held their index, like Index or
+	// SourceIndex. a map per action of the model output, nil for actions without elements
+	InteractedElements []map[string]*HistoryElement
+}
+
+// an element an action used, with what identifies it apart from its index
+type HistoryElement struct {
+	HighlightIndex int
+	TagName        string
+	XPath          string
+	Attributes     map[string]string
+	IdentityHash   string // tag, xpath, attributes and text, see DomElementNode.IdentityHash
+	Hash           string // tag, xpath, ancestors and key attributes, see DomElementNode.Hash
+}
+
+// param fields holding the highlight index of an element
+var elementIndexFields = []string{"Index", "SourceIndex", "TargetIndex"}
+
+func NewHistoryElement(node *browser.DomElementNode) *HistoryElement {
+	e := &HistoryElement{
+		TagName:      node.TagName,
+		XPath:        node.XPath,
+		Attributes:   node.Attributes,
+		IdentityHash: node.IdentityHash(),
+		Hash:         node.Hash(),
+	}
+	if node.HighlightIndex != nil {
+		e.HighlightIndex = *node.HighlightIndex
+	}
+	return e
+}
+
+// element index fields of the params and their values
+func paramIndices(params any) map[string]int {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	indices := make(map[string]int)
+	for _, name := range elementIndexFields {
+		if v, ok := fields[name].(float64); ok {
+			indices[name] = int(v)
+		}
+	}
+	return indices
+}
+
+type StepMetadata struct {
+	Step      int
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+func (m *StepMetadata) Duration() time.Duration {
+	return m.EndTime.Sub(m.StartTime)
+}
+
+// one step of a run, what the agent saw, decided and got
+type AgentHistory struct {
+	State       *HistoryState
+	ModelOutput *AgentOutput // nil when the model gave no valid answer
+	Results     []*ActionResult
+	Metadata    *StepMetadata
+}
+
+// every step of a run in order
+type AgentHistoryList struct {
+	Task    string
+	History []*AgentHistory
+}
+
+func NewHistoryState(state *browser.BrowserState) *HistoryState {
+	h := &HistoryState{
+		Url:        state.Url,
+		Title:      state.Title,
+		Tabs:       state.Tabs,
+		Screenshot: state.ScreentShot,
+	}
+	// only elements with coordinates carry the viewport
+	if state.ElemmentTree != nil && state.ElemmentTree.ViewportInfo.Width > 0 {
+		h.Viewport = state.ElemmentTree.ViewportInfo
+	} else {
+		for _, element := range state.SelectorMap {
+			if element.ViewportInfo.Width > 0 {
+				h.Viewport = element.ViewportInfo
+				break
+			}
+		}
+	}
+	return h
+}
+
+// goals the model set, one per step, empty for steps without an answer
+func (l *AgentHistoryList) Goals() []string {
+	goals := make([]string, 0, len(l.History))
+	for _, h := range l.History {
+		goal := ""
+		if h.ModelOutput != nil {
+			goal = h.ModelOutput.CurrentState.NextGoal
+		}
+		goals = append(goals, goal)
+	}
+	return goals
+}
+
+// errors of the actions of every step, in order
+func (l *AgentHistoryList) Errors() []string {
+	errors := make([]string, 0)
+	for _, h := range l.History {
+		for _, r := range h.Results {
+			if r.Error != "" {
+				errors = append(errors, r.Error)
+			}
+		}
+	}
+	return errors
+}
+
+// whether the last action of the run finished the task
+func (l *AgentHistoryList) IsDone() bool {
+	if len(l.History) == 0 {
+		return false
+	}
+	results := l.History[len(l.History)-1].Results
+	return len(results) > 0 && results[len(results)-1].IsDone
+}
+
+func (l *AgentHistoryList) TotalDuration() time.Duration {
+	var total time.Duration
+	for _, h := range l.History {
+		if h.Metadata != nil {
+			total += h.Metadata.Duration()
+		}
+	}
+	return total
+}
+
+// record a step, state is the one the model decided on and start when the step began
+func (a *Agent) AddHistory(state *browser.BrowserState, output *AgentOutput, results []*ActionResult, start time.Time) *AgentHistory {
+	// actions may read or fail with secret values, the recorded results have their placeholders
+	recorded := make([]*ActionResult, len(results))
+	for i, result := range results {
+		r := *result
+		r.ExtractedContent = a.SensitiveData.Redact(r.ExtractedContent)
+		r.Error = a.SensitiveData.Redact(r.Error)
+		recorded[i] = &r
+	}
+	h := &AgentHistory{
+		ModelOutput: output,
+		Results:     recorded,
+		Metadata: &StepMetadata{
+			Step:      len(a.History.History) + 1,
+			StartTime: start,
+			EndTime:   time.Now(),
+		},
+	}
+	url := ""
+	if state != nil {
+		h.State = NewHistoryState(state)
+		url = state.Url
+		if output != nil {
+			h.State.InteractedElements = interactedElements(state, output.Actions)
+		}
+	}
+	a.History.History = append(a.History.History, h)
+	a.Logger.Debug("step recorded", "step", h.Metadata.Step, "url", url, "results", len(results), "duration", h.Metadata.Duration())
+	return h
+}
+
+// the elements of the state each action refers to by index
+func interactedElements(state *browser.BrowserState, actions []*ActionModel) []map[string]*HistoryElement {
+	ret := make([]map[string]*HistoryElement, len(actions))
+	for i, action := range actions {
+		for field, index := range paramIndices(action.Params) {
+			node := state.SelectorMap[index]
+			if node == nil {
+				continue
+			}
+			if ret[i] == nil {
+				ret[i] = make(map[string]*HistoryElement)
+			}
+			ret[i][field] = NewHistoryElement(node)
+		}
+	}
+	return ret
+}
+
+// write the history as json, screenshots are kept base64 encoded
+func (l *AgentHistoryList) SaveToFile(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadHistoryFromFile(path string) (*AgentHistoryList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l := new(AgentHistoryList)
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid history %s: %w", path, err)
+	}
+	return l, nil
+}
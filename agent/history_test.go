@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+type clickParam struct {
+	Index int
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	index := 4
+	button := &browser.DomElementNode{
+		TagName:        "button",
+		XPath:          "html/body/form/button",
+		Attributes:     map[string]string{"type": "submit"},
+		HighlightIndex: &index,
+	}
+	state := &browser.BrowserState{
+		Url:         "https://example.com/login",
+		Title:       "Login",
+		Tabs:        []*browser.TabInfo{{PageId: 0, Url: "https://example.com/login", Title: "Login"}},
+		ScreentShot: []byte{0x89, 'P', 'N', 'G'},
+	}
+	state.SelectorMap = browser.SelectorMap{index: button}
+	a := &Agent{History: &AgentHistoryList{Task: "log in"}, Logger: controller.DiscardLogger()}
+	output := &AgentOutput{
+		CurrentState: AgentBrain{NextGoal: "submit the form"},
+		Actions:      []*ActionModel{{Name: "click_element", Params: &clickParam{Index: index}}},
+	}
+	start := time.Now().Add(-time.Second)
+	a.AddHistory(state, output, []*ActionResult{{ExtractedContent: "clicked"}}, start)
+	a.AddHistory(state, nil, []*ActionResult{{Error: "invalid answer"}}, time.Now())
+
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := a.History.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadHistoryFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Task != "log in" || len(loaded.History) != 2 {
+		t.Fatalf("loaded %+v", loaded)
+	}
+	first := loaded.History[0]
+	if first.Metadata.Step != 1 || !first.Metadata.StartTime.Equal(start) || first.Metadata.Duration() < time.Second {
+		t.Errorf("metadata %+v", first.Metadata)
+	}
+	if first.State.Url != state.Url || first.State.Title != state.Title || !reflect.DeepEqual(first.State.Screenshot, state.ScreentShot) {
+		t.Errorf("state %+v", first.State)
+	}
+	if first.State.Tabs[0].Url != state.Url {
+		t.Errorf("tabs %+v", first.State.Tabs[0])
+	}
+	if goals := loaded.Goals(); !reflect.DeepEqual(goals, []string{"submit the form", ""}) {
+		t.Errorf("goals %q", goals)
+	}
+	if errors := loaded.Errors(); !reflect.DeepEqual(errors, []string{"invalid answer"}) {
+		t.Errorf("errors %q", errors)
+	}
+	// params come back as json objects, the registry decodes them again on replay
+	action := first.ModelOutput.Actions[0]
+	if action.Name != "click_element" || !reflect.DeepEqual(action.Params, map[string]any{"Index": float64(index)}) {
+		t.Errorf("action %+v", action)
+	}
+	element := first.State.InteractedElements[0]["Index"]
+	if element == nil || element.HighlightIndex != index || element.IdentityHash != button.IdentityHash() || element.Hash != button.Hash() {
+		t.Errorf("interacted element %+v", element)
+	}
+	if loaded.History[1].ModelOutput != nil || loaded.History[1].Metadata.Step != 2 {
+		t.Errorf("second step %+v", loaded.History[1])
+	}
+}
+
+// secrets the actions read or failed with are saved as their placeholders
+func TestHistoryRedactsSecrets(t *testing.T) {
+	a := NewAgent("log in with the password hunter2", browser.NewBrowser(), map[string]string{"password": "hunter2"})
+	results := []*ActionResult{{ExtractedContent: "the field shows hunter2"}, {Error: "hunter2 was rejected"}}
+	a.AddHistory(nil, nil, results, time.Now())
+	path := filepath.Join(t.TempDir(), "history.json")
+	if err := a.History.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("the saved history holds the secret: %s", data)
+	}
+	if strings.Count(string(data), `\u003csecret\u003epassword\u003c/secret\u003e`) != 3 {
+		t.Errorf("the saved history misses the placeholders: %s", data)
+	}
+	// the results of the step are the agent's, only the record is redacted
+	if results[0].ExtractedContent != "the field shows hunter2" {
+		t.Errorf("result changed to %q", results[0].ExtractedContent)
+	}
+}
+
+func TestLoadHistoryFromFileErrors(t *testing.T) {
+	if _, err := LoadHistoryFromFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("a missing file is loaded")
+	}
+}
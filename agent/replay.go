@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+type ReplayOptions struct {
+	StepDelay time.Duration // wait before every step so the page settles
+	CheckUrl  bool          // every step must start on the recorded page, query and fragment aside
+}
+
+func DefaultReplayOptions() *ReplayOptions {
+	return &ReplayOptions{StepDelay: time.Second, CheckUrl: true}
+}
+
+// where a replay stopped following the recording, steps and actions count from 1
+type ReplayDivergence struct {
+	Step   int
+	Action int    // 0 when the step diverged before its actions ran
+	Name   string // the action
+	Reason string
+}
+
+func (e *ReplayDivergence) Error() string {
+	if e.Action == 0 {
+		return fmt.Sprintf("replay diverged at step %d: %s", e.Step, e.Reason)
+	}
+	return fmt.Sprintf("replay diverged at step %d action %d %s: %s", e.Step, e.Action, e.Name, e.Reason)
+}
+
+// run the recorded actions again through the registry without a model. elements are found by their
+// recorded identity instead of their index, a *ReplayDivergence tells the step that went another way
+func Replay(b *browser.Browser, history *AgentHistoryList, options *ReplayOptions) ([]*ActionResult, error) {
+	if options == nil {
+		options = DefaultReplayOptions()
+	}
+	logger := b.Logger
+	if logger == nil {
+		logger = controller.DiscardLogger()
+	}
+	results := make([]*ActionResult, 0)
+	for n, h := range history.History {
+		step := n + 1
+		if h.Metadata != nil {
+			step = h.Metadata.Step
+		}
+		if h.ModelOutput == nil || len(h.ModelOutput.Actions) == 0 {
+			continue
+		}
+		time.Sleep(options.StepDelay)
+		if err := b.UpdateState(); err != nil {
+			return results, err
+		}
+		state := b.GetState()
+		if options.CheckUrl && h.State != nil && !samePage(h.State.Url, state.Url) {
+			return results, &ReplayDivergence{Step: step, Reason: fmt.Sprintf("the page is %s, it was %s", state.Url, h.State.Url)}
+		}
+		for i, action := range h.ModelOutput.Actions {
+			diverged := func(reason string) error {
+				return &ReplayDivergence{Step: step, Action: i + 1, Name: action.Name, Reason: reason}
+			}
+			registered := controller.GetAction(action.Name)
+			if registered == nil {
+				return results, diverged("the action is not registered")
+			}
+			params := action.Params
+			var elements map[string]*HistoryElement
+			if h.State != nil && i < len(h.State.InteractedElements) {
+				elements = h.State.InteractedElements[i]
+			}
+			if len(elements) > 0 {
+				if i > 0 {
+					// the previous action may have changed the page
+					if err := b.UpdateState(); err != nil {
+						return results, err
+					}
+					state = b.GetState()
+				}
+				var err error
+				if params, err = relocateParams(state, action.Params, elements); err != nil {
+					return results, diverged(err.Error())
+				}
+			}
+			var recorded *ActionResult
+			if i < len(h.Results) {
+				recorded = h.Results[i]
+			}
+			result, err := registered.Execute(logger, b.SensitiveData, b, params)
+			if err != nil {
+				if recorded != nil && recorded.Error != "" {
+					// it failed in the recording too
+					logger.Info("replayed action failed as recorded", "step", step, "action", action.Name, "error", err)
+					results = append(results, &ActionResult{Error: err.Error()})
+					continue
+				}
+				return results, diverged(err.Error())
+			}
+			if recorded != nil && recorded.Error != "" {
+				return results, diverged("it succeeded but failed in the recording: " + recorded.Error)
+			}
+			logger.Debug("action replayed", "step", step, "action", action.Name)
+			results = append(results, result)
+			if result.IsDone {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// the params with their index fields pointing at the recorded elements of the current state
+func relocateParams(state *browser.BrowserState, params any, elements map[string]*HistoryElement) (map[string]any, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]any)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for field, element := range elements {
+		node, err := findElement(state.SelectorMap, element)
+		if err != nil {
+			return nil, err
+		}
+		fields[field] = *node.HighlightIndex
+	}
+	return fields, nil
+}
+
+// the element of the selector map with the identity of the recorded one, by the strict identity
+// first and by the structural hash when the text or attributes changed
+func findElement(selectorMap browser.SelectorMap, element *HistoryElement) (*browser.DomElementNode, error) {
+	matchers := []func(node *browser.DomElementNode) bool{
+		func(node *browser.DomElementNode) bool { return node.IdentityHash() == element.IdentityHash },
+		func(node *browser.DomElementNode) bool { return node.Hash() == element.Hash },
+	}
+	for _, match := range matchers {
+		var found []*browser.DomElementNode
+		for _, node := range selectorMap {
+			if match(node) {
+				found = append(found, node)
+			}
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+		if len(found) > 1 {
+			return nil, fmt.Errorf("%d elements match the recorded [%d]<%s> %s", len(found), element.HighlightIndex, element.TagName, element.XPath)
+		}
+	}
+	return nil, fmt.Errorf("the recorded [%d]<%s> %s is not on the page", element.HighlightIndex, element.TagName, element.XPath)
+}
+
+// same host and path, query and fragment often carry session values
+func samePage(recorded, current string) bool {
+	r, err1 := url.Parse(recorded)
+	c, err2 := url.Parse(current)
+	if err1 != nil || err2 != nil {
+		return recorded == current
+	}
+	return r.Scheme == c.Scheme && r.Opaque == c.Opaque && r.Host == c.Host &&
+		strings.TrimSuffix(r.Path, "/") == strings.TrimSuffix(c.Path, "/")
+}
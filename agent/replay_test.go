@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+)
+
+func newIndexedNode(index int, tag string, xpath string, attributes map[string]string, text string) *browser.DomElementNode {
+	node := &browser.DomElementNode{
+		TagName:        tag,
+		XPath:          xpath,
+		Attributes:     attributes,
+		HighlightIndex: &index,
+	}
+	node.Childrens = []browser.DomNodeI{&browser.DomTextNode{Text: text}}
+	return node
+}
+
+func TestFindElement(t *testing.T) {
+	save := newIndexedNode(3, "button", "html/body/form/button[1]", map[string]string{"id": "save"}, "Save")
+	cancel := newIndexedNode(4, "button", "html/body/form/button[2]", map[string]string{"id": "cancel"}, "Cancel")
+	// the text changed since the recording, the structural hash still matches
+	renamed := newIndexedNode(7, "button", "html/body/form/button[1]", map[string]string{"id": "save"}, "Save draft")
+	twin := newIndexedNode(8, "button", "html/body/form/button[1]", map[string]string{"id": "save"}, "Save")
+	recorded := NewHistoryElement(save)
+
+	tests := []struct {
+		name        string
+		selectorMap browser.SelectorMap
+		want        int // highlight index, -1 for an error
+		err         string
+	}{
+		{"same index", browser.SelectorMap{3: save, 4: cancel}, 3, ""},
+		{"moved index", browser.SelectorMap{0: cancel, 9: newIndexedNode(9, "button", save.XPath, save.Attributes, "Save")}, 9, ""},
+		{"changed text", browser.SelectorMap{4: cancel, 7: renamed}, 7, ""},
+		{"ambiguous", browser.SelectorMap{3: save, 8: twin}, -1, "2 elements match"},
+		{"missing", browser.SelectorMap{4: cancel}, -1, "is not on the page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := findElement(tt.selectorMap, recorded)
+			if tt.want < 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *node.HighlightIndex != tt.want {
+				t.Errorf("found [%d], want [%d]", *node.HighlightIndex, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelocateParams(t *testing.T) {
+	source := newIndexedNode(2, "div", "html/body/ul/li[1]", map[string]string{"draggable": "true"}, "first")
+	target := newIndexedNode(5, "div", "html/body/ul/li[3]", map[string]string{"draggable": "true"}, "third")
+	elements := map[string]*HistoryElement{"SourceIndex": NewHistoryElement(source), "TargetIndex": NewHistoryElement(target)}
+	// the list was rendered again with other indices
+	state := &browser.BrowserState{}
+	state.SelectorMap = browser.SelectorMap{
+		10: newIndexedNode(10, "div", source.XPath, source.Attributes, "first"),
+		11: newIndexedNode(11, "div", target.XPath, target.Attributes, "third"),
+	}
+	targetIndex := 5
+	params := &browser.DragAndDropParam{SourceIndex: 2, TargetIndex: &targetIndex, OffsetX: 3}
+	got, err := relocateParams(state, params, elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"SourceIndex": 10, "TargetIndex": 11, "OffsetX": float64(3), "OffsetY": float64(0)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("relocateParams = %v, want %v", got, want)
+	}
+
+	delete(state.SelectorMap, 11)
+	if _, err := relocateParams(state, params, elements); err == nil {
+		t.Error("params of a missing element are relocated")
+	}
+}
+
+func TestSamePage(t *testing.T) {
+	tests := []struct {
+		recorded string
+		current  string
+		want     bool
+	}{
+		{"https://example.com/cart", "https://example.com/cart", true},
+		{"https://example.com/cart", "https://example.com/cart/", true},
+		{"https://example.com/cart?session=1", "https://example.com/cart?session=2#items", true},
+		{"https://example.com/cart", "https://example.com/checkout", false},
+		{"https://example.com/cart", "https://shop.example.com/cart", false},
+		{"https://example.com/cart", "http://example.com/cart", false},
+		{"about:blank", "about:blank", true},
+		{"about:blank", "about:srcdoc", false},
+		{"%zz", "%zz", true},
+	}
+	for _, tt := range tests {
+		if got := samePage(tt.recorded, tt.current); got != tt.want {
+			t.Errorf("samePage(%q, %q) = %v, want %v", tt.recorded, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestReplayDivergenceError(t *testing.T) {
+	step := &ReplayDivergence{Step: 2, Reason: "the page is b, it was a"}
+	if got := step.Error(); got != "replay diverged at step 2: the page is b, it was a" {
+		t.Errorf("Error() = %q", got)
+	}
+	action := &ReplayDivergence{Step: 2, Action: 1, Name: "click_element", Reason: "gone"}
+	if got := action.Error(); got != "replay diverged at step 2 action 1 click_element: gone" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func chromeInstalled() bool {
+	for _, name := range []string{"headless_shell", "headless-shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReplay(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><button id="save" onclick="this.textContent='Saved'">Save</button></body></html>`))
+	}))
+	defer server.Close()
+	b := browser.NewBrowser()
+	defer b.Close()
+	if err := b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UpdateState(); err != nil {
+		t.Fatal(err)
+	}
+	state := b.GetState()
+	var button *browser.DomElementNode
+	for _, node := range state.SelectorMap {
+		if node.Attributes["id"] == "save" {
+			button = node
+		}
+	}
+	if button == nil {
+		t.Fatal("the button is not in the state")
+	}
+	recording := func(url string, element *HistoryElement) *AgentHistoryList {
+		return &AgentHistoryList{History: []*AgentHistory{{
+			State: &HistoryState{Url: url, InteractedElements: []map[string]*HistoryElement{{"Index": element}}},
+			ModelOutput: &AgentOutput{Actions: []*ActionModel{
+				{Name: "click_element", Params: &browser.ClickElementParam{Index: *button.HighlightIndex}},
+			}},
+			Results:  []*ActionResult{{}},
+			Metadata: &StepMetadata{Step: 1},
+		}}}
+	}
+	options := &ReplayOptions{CheckUrl: true}
+
+	results, err := Replay(b, recording(server.URL+"/", NewHistoryElement(button)), options)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("replay of the recorded click: %v, %d results", err, len(results))
+	}
+
+	missing := NewHistoryElement(button)
+	missing.XPath, missing.IdentityHash, missing.Hash = "html/body/form/button", "identity", "hash"
+	_, err = Replay(b, recording(server.URL, missing), options)
+	var divergence *ReplayDivergence
+	if !errors.As(err, &divergence) {
+		t.Fatalf("replay with a missing element: %v", err)
+	}
+	if divergence.Step != 1 || divergence.Action != 1 || divergence.Name != "click_element" || !strings.Contains(divergence.Reason, "is not on the page") {
+		t.Errorf("divergence %+v", divergence)
+	}
+
+	_, err = Replay(b, recording("https://example.com/", NewHistoryElement(button)), options)
+	if !errors.As(err, &divergence) || divergence.Action != 0 {
+		t.Errorf("replay on another page: %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+//go:embed system_prompt.md
+var systemPrompt string
+
+// a chat model, it answers the messages with the next assistant message
+type Model interface {
+	Chat(ctx context.Context, messages []*controller.Message) (string, error)
+}
+
+type DoneParam struct {
+	Text    string // everything found for the task
+	Success bool   // whether the task is completed
+}
+
+// the system message with the rules and the registered actions
+func (a *Agent) systemMessage() *controller.Message {
+	prompt := strings.ReplaceAll(systemPrompt, "{{max_actions}}", fmt.Sprint(a.MaxActionsPerStep))
+	// the prompt is written with escaped braces
+	prompt = strings.NewReplacer("{{", "{", "}}", "}").Replace(prompt)
+	actions := make([]string, 0)
+	for _, action := range controller.GetActions() {
+		if action.Handler != nil {
+			actions = append(actions, "- "+action.Prompt())
+		}
+	}
+	prompt += "\n\n# Available actions\n" + strings.Join(actions, "\n")
+	return &controller.Message{Role: "system", Content: prompt}
+}
+
+// run the task until the model calls done, for at most maxSteps steps. the history is returned
+// even when the run fails
+func (a *Agent) Run(ctx context.Context, model Model, maxSteps int) (*AgentHistoryList, error) {
+	if a.MaxActionsPerStep < 1 {
+		return a.History, fmt.Errorf("MaxActionsPerStep is %d, at least one action has to run in a step", a.MaxActionsPerStep)
+	}
+	failures := 0
+	for step := 1; step <= maxSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return a.History, err
+		}
+		h, err := a.Step(ctx, model)
+		if err != nil {
+			if ctx.Err() != nil {
+				return a.History, ctx.Err()
+			}
+			failures++
+			if failures >= a.MaxFailures {
+				return a.History, fmt.Errorf("stopped after %d failures in a row: %w", failures, err)
+			}
+			continue
+		}
+		last := h.Results[len(h.Results)-1]
+		if last.IsDone {
+			return a.History, nil
+		}
+		if last.Error != "" {
+			failures++
+			if failures >= a.MaxFailures {
+				return a.History, fmt.Errorf("stopped after %d failures in a row: %s", failures, last.Error)
+			}
+		} else {
+			failures = 0
+		}
+	}
+	return a.History, fmt.Errorf("the task is not done after %d steps", maxSteps)
+}
+
+// one step, the model decides on the current state and its actions run. the step is recorded in
+// the history either way, the error is the one of reading the state or of the model when it gave
+// no usable answer
+func (a *Agent) Step(ctx context.Context, model Model) (*AgentHistory, error) {
+	start := time.Now()
+	if err := a.Browser.UpdateState(); err != nil {
+		err = fmt.Errorf("read the browser state: %w", err)
+		return a.AddHistory(nil, nil, []*ActionResult{{Error: err.Error()}}, start), err
+	}
+	state := a.Browser.GetState()
+	if err := a.AddStateMessage(state); err != nil {
+		err = fmt.Errorf("serialize the browser state: %w", err)
+		return a.AddHistory(state, nil, []*ActionResult{{Error: err.Error()}}, start), err
+	}
+	output, err := a.next(ctx, model, a.systemMessage())
+	if err != nil {
+		h := a.AddHistory(state, nil, []*ActionResult{{Error: err.Error()}}, start)
+		a.MessageManager.AddMessage("user", "Your answer could not be used: "+err.Error())
+		return h, err
+	}
+	results := a.execute(output.Actions)
+	h := a.AddHistory(state, output, results, start)
+	a.addResultMessage(results)
+	return h, nil
+}
+
+// ask the model for the next actions
+func (a *Agent) next(ctx context.Context, model Model, system *controller.Message) (*AgentOutput, error) {
+	messages := append([]*controller.Message{system}, a.MessageManager.History...)
+	answer, err := model.Chat(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	a.MessageManager.AddMessage("assistant", answer)
+	output, err := parseModelOutput(answer)
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Actions) > a.MaxActionsPerStep {
+		output.Actions = output.Actions[:a.MaxActionsPerStep]
+	}
+	a.Logger.Info("model output", "next_goal", output.CurrentState.NextGoal, "actions", len(output.Actions))
+	return output, nil
+}
+
+// the answer in the format of the system prompt, the params are decoded to their registered types
+func parseModelOutput(answer string) (*AgentOutput, error) {
+	// models like to wrap json in code fences
+	begin, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if begin < 0 || end < begin {
+		return nil, errors.New("the answer is not json")
+	}
+	var raw struct {
+		CurrentState struct {
+			EvaluationPreviousGoal string `json:"evaluation_previous_goal"`
+			Memory                 string `json:"memory"`
+			NextGoal               string `json:"next_goal"`
+		} `json:"current_state"`
+		Action []map[string]json.RawMessage `json:"action"`
+	}
+	if err := json.Unmarshal([]byte(answer[begin:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid answer: %w", err)
+	}
+	if len(raw.Action) == 0 {
+		return nil, errors.New("the answer has no action")
+	}
+	output := &AgentOutput{
+		CurrentState: AgentBrain{
+			EvaluationPreviousGoal: raw.CurrentState.EvaluationPreviousGoal,
+			Memory:                 raw.CurrentState.Memory,
+			NextGoal:               raw.CurrentState.NextGoal,
+		},
+	}
+	for i, item := range raw.Action {
+		if len(item) != 1 {
+			return nil, fmt.Errorf("action %d has %d names, want one", i+1, len(item))
+		}
+		for name, params := range item {
+			action := controller.GetAction(name)
+			if action == nil || action.Handler == nil {
+				return nil, fmt.Errorf("unknown action %s", name)
+			}
+			value, err := action.DecodeParams(params)
+			if err != nil {
+				return nil, err
+			}
+			output.Actions = append(output.Actions, &ActionModel{Name: name, Params: value})
+		}
+	}
+	return output, nil
+}
+
+// run the actions in order, the sequence stops at a failure or when the task is done
+func (a *Agent) execute(actions []*ActionModel) []*ActionResult {
+	results := make([]*ActionResult, 0, len(actions))
+	for _, action := range actions {
+		result, err := controller.GetAction(action.Name).Execute(a.Logger, a.SensitiveData, a.Browser, action.Params)
+		if err != nil {
+			results = append(results, &ActionResult{Error: err.Error()})
+			break
+		}
+		results = append(results, result)
+		if result.IsDone {
+			break
+		}
+	}
+	return results
+}
+
+// tell the model what its actions found and why they failed
+func (a *Agent) addResultMessage(results []*ActionResult) {
+	lines := make([]string, 0, len(results))
+	for i, r := range results {
+		if r.Error != "" {
+			lines = append(lines, fmt.Sprintf("Action %d failed: %s", i+1, r.Error))
+		} else if r.IncludeInMemory && r.ExtractedContent != "" {
+			lines = append(lines, fmt.Sprintf("Action %d result: %s", i+1, r.ExtractedContent))
+		}
+	}
+	if len(lines) > 0 {
+		a.MessageManager.AddMessage("user", strings.Join(lines, "\n"))
+	}
+}
+
+func init() {
+	controller.RegistryAction("done", "Complete the task, text has everything found for the task and success whether it is completed", new(DoneParam), func(_ any, params any) (*ActionResult, error) {
+		param := params.(*DoneParam)
+		return &ActionResult{
+			IsDone:           true,
+			Success:          param.Success,
+			ExtractedContent: param.Text,
+			IncludeInMemory:  true,
+		}, nil
+	})
+}
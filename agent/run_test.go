@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+const doneAnswer = `{"current_state": {"next_goal": "finish"}, "action": [{"done": {"text": "found it", "success": true}}]}`
+
+func TestParseModelOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		actions []*ActionModel
+		err     string
+	}{
+		{"plain", doneAnswer, []*ActionModel{{Name: "done", Params: &DoneParam{Text: "found it", Success: true}}}, ""},
+		{"fenced", "Here you go:\n```json\n" + doneAnswer + "\n```", []*ActionModel{{Name: "done", Params: &DoneParam{Text: "found it", Success: true}}}, ""},
+		{"sequence", `{"action": [{"input_text": {"index": 2, "input": "alice"}}, {"click_element": {"index": 3}}]}`, []*ActionModel{
+			{Name: "input_text", Params: &browser.InputTextParam{Index: 2, Input: "alice"}},
+			{Name: "click_element", Params: &browser.ClickElementParam{Index: 3}},
+		}, ""},
+		{"action without params", `{"action": [{"go_back": {}}]}`, []*ActionModel{{Name: "go_back"}}, ""},
+		{"not json", "I will click the button", nil, "not json"},
+		{"invalid json", `{"action": [{"done": }]}`, nil, "invalid answer"},
+		{"no action", `{"current_state": {"next_goal": "think"}, "action": []}`, nil, "no action"},
+		{"two names in an item", `{"action": [{"go_back": {}, "go_forward": {}}]}`, nil, "action 1 has 2 names"},
+		{"no name in an item", `{"action": [{"go_back": {}}, {}]}`, nil, "action 2 has 0 names"},
+		{"unknown action", `{"action": [{"extract_content": {"goal": "names"}}]}`, nil, "unknown action extract_content"},
+		{"unknown param", `{"action": [{"input_text": {"index": 2, "text": "alice"}}]}`, nil, "invalid params of input_text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := parseModelOutput(tt.answer)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(output.Actions, tt.actions) {
+				got, _ := json.Marshal(output.Actions)
+				t.Errorf("actions %s", got)
+			}
+		})
+	}
+	output, _ := parseModelOutput(doneAnswer)
+	if output.CurrentState.NextGoal != "finish" {
+		t.Errorf("state %+v", output.CurrentState)
+	}
+}
+
+// the action sequences the system prompt shows are valid answers
+func TestSystemPromptExamples(t *testing.T) {
+	a := &Agent{MaxActionsPerStep: 10}
+	prompt := a.systemMessage().Content
+	examples := 0
+	for _, line := range strings.Split(prompt, "\n") {
+		_, sequence, ok := strings.Cut(line, ": [{")
+		if !ok || !strings.HasPrefix(line, "- ") {
+			continue
+		}
+		examples++
+		if _, err := parseModelOutput(`{"action": [{` + sequence + `}`); err != nil {
+			t.Errorf("example %q: %v", line, err)
+		}
+	}
+	if examples == 0 {
+		t.Error("no example sequences in the prompt")
+	}
+	if strings.Contains(prompt, "{{") || !strings.Contains(prompt, "maximum 10 actions") {
+		t.Error("the prompt is not filled in")
+	}
+}
+
+// answers the chat with the answers in order, answers starting with "error:" fail
+type fakeModel struct {
+	answers []string
+	calls   int
+}
+
+func (m *fakeModel) Chat(ctx context.Context, messages []*controller.Message) (string, error) {
+	if m.calls >= len(m.answers) {
+		return "", errors.New("no more answers")
+	}
+	answer := m.answers[m.calls]
+	m.calls++
+	if message, ok := strings.CutPrefix(answer, "error:"); ok {
+		return "", errors.New(message)
+	}
+	return answer, nil
+}
+
+func TestRun(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	b := browser.NewBrowser()
+	defer b.Close()
+	const (
+		extract = `{"action": [{"extract": {}}]}`
+		missing = `{"action": [{"click_element": {"index": 999}}]}`
+	)
+	tests := []struct {
+		name     string
+		answers  []string
+		maxSteps int
+		steps    int // recorded history
+		err      string
+	}{
+		{"done at once", []string{doneAnswer}, 5, 1, ""},
+		{"invalid answers in a row", []string{"no json", `{"action": []}`, `{"action": [{"nope": {}}]}`}, 5, 3, "stopped after 3 failures in a row: unknown action nope"},
+		{"model errors in a row", []string{"error:rate limited", "error:rate limited", "error:rate limited"}, 5, 3, "stopped after 3 failures in a row: rate limited"},
+		{"failed actions in a row", []string{missing, missing, missing}, 5, 3, "stopped after 3 failures in a row"},
+		{"a success resets the failures", []string{"no json", missing, extract, "no json", missing, doneAnswer}, 10, 6, ""},
+		{"out of steps", []string{extract, extract, extract}, 2, 2, "not done after 2 steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAgent("test task", b, nil)
+			history, err := a.Run(context.Background(), &fakeModel{answers: tt.answers}, tt.maxSteps)
+			if tt.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("error %v, want %q", err, tt.err)
+			}
+			if len(history.History) != tt.steps {
+				t.Errorf("%d steps recorded, want %d", len(history.History), tt.steps)
+			}
+			if history.IsDone() != (tt.err == "") {
+				t.Errorf("IsDone %v", history.IsDone())
+			}
+		})
+	}
+
+	a := NewAgent("test task", b, nil)
+	a.MaxActionsPerStep = 0
+	if _, err := a.Run(context.Background(), &fakeModel{answers: []string{doneAnswer}}, 1); err == nil {
+		t.Error("a run without actions per step is started")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewAgent("test task", b, nil).Run(ctx, &fakeModel{answers: []string{doneAnswer}}, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled run: %v", err)
+	}
+}
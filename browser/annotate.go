@@ -0,0 +1,135 @@
+package browser
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// the colors of highlightElement in buildDomTree.js, by index
+var highlightColors = []color.RGBA{
+	{0xFF, 0x00, 0x00, 0xFF},
+	{0x00, 0xFF, 0x00, 0xFF},
+	{0x00, 0x00, 0xFF, 0xFF},
+	{0xFF, 0xA5, 0x00, 0xFF},
+	{0x80, 0x00, 0x80, 0xFF},
+	{0x00, 0x80, 0x80, 0xFF},
+	{0xFF, 0x69, 0xB4, 0xFF},
+	{0x4B, 0x00, 0x82, 0xFF},
+	{0xFF, 0x45, 0x00, 0xFF},
+	{0x2E, 0x8B, 0x57, 0xFF},
+	{0xDC, 0x14, 0x3C, 0xFF},
+	{0x46, 0x82, 0xB4, 0xFF},
+}
+
+// 3x5 bitmaps of the digits, a row per byte with the leftmost pixel in bit 2
+var digitGlyphs = [10][5]byte{
+	{7, 5, 5, 5, 7},
+	{2, 6, 2, 2, 7},
+	{7, 1, 7, 4, 7},
+	{7, 1, 7, 1, 7},
+	{5, 5, 7, 1, 1},
+	{7, 4, 7, 1, 7},
+	{7, 4, 7, 5, 7},
+	{7, 1, 1, 1, 1},
+	{7, 5, 7, 5, 7},
+	{7, 5, 7, 1, 7},
+}
+
+// draw a box and an index label for every element on the screenshot, the page is not touched.
+// fullPage selects page coordinates instead of viewport coordinates, scale is image pixels per css
+// pixel, 0 for 1. the image keeps its format, png or jpeg
+func AnnotateScreenshot(data []byte, elements SelectorMap, fullPage bool, scale float64) ([]byte, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode screenshot: %w", err)
+	}
+	img := toRGBA(src)
+	annotateImage(img, elements, fullPage, scale)
+	return encodeImage(img, format, 90)
+}
+
+func annotateImage(img *image.RGBA, elements SelectorMap, fullPage bool, scale float64) {
+	if scale <= 0 {
+		scale = 1
+	}
+	indices := make([]int, 0, len(elements))
+	for index := range elements {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	// pixels of one glyph dot and of the box border
+	dot := int(math.Max(1, math.Round(2*scale)))
+	border := int(math.Max(1, math.Round(2*scale)))
+	for _, index := range indices {
+		coords := elements[index].ViewportCoordinates
+		if fullPage {
+			coords = elements[index].PageCoordinates
+		}
+		if coords.IsEmpty() {
+			continue
+		}
+		c := highlightColors[index%len(highlightColors)]
+		box := image.Rect(
+			int(math.Round(float64(coords.TopLeft.X)*scale)),
+			int(math.Round(float64(coords.TopLeft.Y)*scale)),
+			int(math.Round(float64(coords.TopLeft.X+coords.Width)*scale)),
+			int(math.Round(float64(coords.TopLeft.Y+coords.Height)*scale)),
+		).Intersect(img.Bounds())
+		if box.Empty() {
+			continue
+		}
+		drawBorder(img, box, border, c)
+		drawLabel(img, box, index, dot, c)
+	}
+}
+
+func drawBorder(img *image.RGBA, box image.Rectangle, width int, c color.RGBA) {
+	fill := image.NewUniform(c)
+	sides := []image.Rectangle{
+		image.Rect(box.Min.X, box.Min.Y, box.Max.X, box.Min.Y+width),
+		image.Rect(box.Min.X, box.Max.Y-width, box.Max.X, box.Max.Y),
+		image.Rect(box.Min.X, box.Min.Y, box.Min.X+width, box.Max.Y),
+		image.Rect(box.Max.X-width, box.Min.Y, box.Max.X, box.Max.Y),
+	}
+	for _, side := range sides {
+		draw.Draw(img, side.Intersect(box), fill, image.Point{}, draw.Src)
+	}
+}
+
+// the index in white on the element color, inside the top right corner like the script's label
+func drawLabel(img *image.RGBA, box image.Rectangle, index int, dot int, c color.RGBA) {
+	text := fmt.Sprint(index)
+	padding := dot
+	width := len(text)*4*dot - dot + 2*padding
+	height := 5*dot + 2*padding
+	label := image.Rect(box.Max.X-width, box.Min.Y, box.Max.X, box.Min.Y+height)
+	if label.Min.X < img.Bounds().Min.X {
+		label = label.Add(image.Pt(img.Bounds().Min.X-label.Min.X, 0))
+	}
+	draw.Draw(img, label.Intersect(img.Bounds()), image.NewUniform(c), image.Point{}, draw.Src)
+	white := image.NewUniform(color.White)
+	x := label.Min.X + padding
+	for _, r := range text {
+		glyph := digitGlyphs[r-'0']
+		for row, bits := range glyph {
+			for col := 0; col < 3; col++ {
+				if bits&(4>>col) == 0 {
+					continue
+				}
+				pixel := image.Rect(x+col*dot, label.Min.Y+padding+row*dot, x+(col+1)*dot, label.Min.Y+padding+(row+1)*dot)
+				draw.Draw(img, pixel.Intersect(img.Bounds()), white, image.Point{}, draw.Src)
+			}
+		}
+		x += 4 * dot
+	}
+}
+
+// full page screenshot with the elements of the cached state drawn on it in go
+func (b *Browser) AnnotatedScreenshot() ([]byte, error) {
+	return b.screenshot(DefaultScreenshotOptions(), b.getSelectorMap())
+}
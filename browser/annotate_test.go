@@ -0,0 +1,149 @@
+package browser
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+var (
+	white = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	red   = highlightColors[0]
+	green = highlightColors[1]
+)
+
+func newWhiteImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+	return img
+}
+
+func boxElement(index int, x, y, width, height int) *DomElementNode {
+	coords := CoordinateSet{TopLeft: Coordinates{X: x, Y: y}, Width: width, Height: height}
+	return &DomElementNode{HighlightIndex: &index, ViewportCoordinates: coords, PageCoordinates: coords}
+}
+
+func TestDrawBorder(t *testing.T) {
+	img := newWhiteImage(20, 20)
+	drawBorder(img, image.Rect(2, 2, 12, 10), 2, red)
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{2, 2, red},   // top left corner
+		{11, 9, red},  // bottom right corner, the box max is exclusive
+		{7, 3, red},   // top side, 2 pixels wide
+		{7, 8, red},   // bottom side
+		{3, 5, red},   // left side
+		{10, 5, red},  // right side
+		{7, 5, white}, // inside
+		{4, 4, white},
+		{1, 1, white}, // outside
+		{12, 10, white},
+	}
+	for _, tt := range tests {
+		if got := img.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("pixel %d,%d is %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestDrawLabel(t *testing.T) {
+	img := newWhiteImage(30, 20)
+	// the label of 7 is 5x7 pixels with a dot of 1, in the top right corner of the box
+	drawLabel(img, image.Rect(5, 5, 25, 15), 7, 1, green)
+	rows := []string{
+		"ggggg",
+		"gwwwg",
+		"gggwg",
+		"gggwg",
+		"gggwg",
+		"gggwg",
+		"ggggg",
+	}
+	colors := map[byte]color.RGBA{'g': green, 'w': white}
+	for row, pixels := range rows {
+		for col := range pixels {
+			if got := img.RGBAAt(20+col, 5+row); got != colors[pixels[col]] {
+				t.Errorf("pixel %d,%d is %v, want %c", 20+col, 5+row, got, pixels[col])
+			}
+		}
+	}
+	if got := img.RGBAAt(19, 5); got != white {
+		t.Errorf("the label is wider than its text, %v left of it", got)
+	}
+
+	// a label wider than the space left of the box is moved into the image
+	img = newWhiteImage(30, 20)
+	drawLabel(img, image.Rect(0, 0, 4, 4), 123, 1, green)
+	if got := img.RGBAAt(0, 0); got != green {
+		t.Errorf("the label does not start at the image edge, %v", got)
+	}
+	if got := img.RGBAAt(12, 0); got != green {
+		t.Errorf("the label of 3 digits is cut, %v", got)
+	}
+}
+
+func TestAnnotateImage(t *testing.T) {
+	elements := SelectorMap{
+		0: boxElement(0, 10, 10, 20, 10),
+		1: boxElement(1, 0, 0, 0, 0),     // not rendered
+		2: boxElement(2, 200, 200, 5, 5), // outside the image
+	}
+	elements[0].PageCoordinates.TopLeft = Coordinates{X: 10, Y: 40}
+
+	img := newWhiteImage(100, 100)
+	annotateImage(img, elements, false, 0)
+	if got := img.RGBAAt(10, 10); got != red {
+		t.Errorf("viewport box corner is %v", got)
+	}
+	if got := img.RGBAAt(10, 40); got != white {
+		t.Errorf("the page box is drawn, %v", got)
+	}
+
+	img = newWhiteImage(100, 100)
+	annotateImage(img, elements, true, 0)
+	if got := img.RGBAAt(10, 40); got != red {
+		t.Errorf("page box corner is %v", got)
+	}
+
+	// two image pixels per css pixel
+	img = newWhiteImage(100, 100)
+	annotateImage(img, elements, false, 2)
+	if got := img.RGBAAt(20, 20); got != red {
+		t.Errorf("scaled box corner is %v", got)
+	}
+	if got := img.RGBAAt(10, 30); got != white {
+		t.Errorf("the unscaled box is drawn, %v", got)
+	}
+	if got := img.RGBAAt(20, 39); got != red {
+		t.Errorf("scaled box bottom is %v", got)
+	}
+}
+
+func TestAnnotateScreenshot(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newWhiteImage(50, 50)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := AnnotateScreenshot(buf.Bytes(), SelectorMap{0: boxElement(0, 5, 5, 30, 20)}, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, format, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" {
+		t.Errorf("format %s", format)
+	}
+	if r, g, b, _ := img.At(5, 5).RGBA(); r>>8 != 0xFF || g != 0 || b != 0 {
+		t.Errorf("box corner is %v", img.At(5, 5))
+	}
+	if _, err := AnnotateScreenshot([]byte("not an image"), nil, false, 1); err == nil {
+		t.Error("an invalid image is annotated")
+	}
+}
@@ -0,0 +1,379 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/chromedp/cdproto/accessibility"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	jsonv2 "github.com/go-json-experiment/json"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+const (
+	DomBackendScript        = "script"        // buildDomTree.js injected in every frame
+	DomBackendAccessibility = "accessibility" // Accessibility.getFullAXTree, no script is run in the page
+)
+
+// roles the model can interact with, focusable nodes of other roles are interactive too
+var axInteractiveRoles = map[string]bool{
+	"button":             true,
+	"link":               true,
+	"textbox":            true,
+	"searchbox":          true,
+	"combobox":           true,
+	"checkbox":           true,
+	"radio":              true,
+	"switch":             true,
+	"slider":             true,
+	"spinbutton":         true,
+	"menuitem":           true,
+	"menuitemcheckbox":   true,
+	"menuitemradio":      true,
+	"option":             true,
+	"tab":                true,
+	"treeitem":           true,
+	"listbox":            true,
+	"DisclosureTriangle": true, // <summary>
+}
+
+// states exposed as aria attributes of the element
+var axStateAttributes = map[accessibility.PropertyName]string{
+	accessibility.PropertyNameExpanded: "aria-expanded",
+	accessibility.PropertyNameChecked:  "aria-checked",
+	accessibility.PropertyNameSelected: "aria-selected",
+	accessibility.PropertyNameDisabled: "aria-disabled",
+	accessibility.PropertyNamePressed:  "aria-pressed",
+	accessibility.PropertyNameRequired: "aria-required",
+}
+
+// scroll and size of the frame's window, as buildDomTree.js gives them
+var frameViewportJs = `({
+  scrollX: Math.round(window.scrollX),
+  scrollY: Math.round(window.scrollY),
+  width: window.innerWidth,
+  height: window.innerHeight,
+})`
+
+// dom node of an accessibility node, with the xpath buildDomTree.js would give it
+type axDomNode struct {
+	node  *cdp.Node
+	xpath string
+}
+
+// dom nodes of a target by backend node id, including same process frames and shadow roots
+func getAxDomNodes(ctx context.Context) (map[cdp.BackendNodeID]*axDomNode, error) {
+	var root *cdp.Node
+	if err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		root, err = dom.GetDocument().WithDepth(-1).WithPierce(true).Do(ctx)
+		return err
+	})); err != nil {
+		return nil, err
+	}
+	nodes := make(map[cdp.BackendNodeID]*axDomNode)
+	// the xpath starts again below documents and shadow roots, like getXPathTree
+	var walkFn func(node *cdp.Node, xpath string)
+	walkFn = func(node *cdp.Node, xpath string) {
+		nodes[node.BackendNodeID] = &axDomNode{node: node, xpath: xpath}
+		counts := make(map[string]int)
+		for _, child := range node.Children {
+			if child.NodeType != cdp.NodeTypeElement {
+				walkFn(child, "")
+				continue
+			}
+			counts[child.NodeName]++
+			segment := child.LocalName
+			if counts[child.NodeName] > 1 {
+				segment += fmt.Sprintf("[%d]", counts[child.NodeName])
+			}
+			if xpath != "" {
+				segment = xpath + "/" + segment
+			}
+			walkFn(child, segment)
+		}
+		for _, shadowRoot := range node.ShadowRoots {
+			walkFn(shadowRoot, "")
+		}
+		if node.ContentDocument != nil {
+			walkFn(node.ContentDocument, "")
+		}
+	}
+	walkFn(root, "")
+	return nodes, nil
+}
+
+// build the tree of one frame from its accessibility tree, interactive nodes in the viewport get
+// indices from highlightIndexStart. coordinates are relative to the frame like the script backend's
+func (d *DomService) buildAXTree(frame *frameContext, highlightIndexStart int, domNodes map[cdp.BackendNodeID]*axDomNode) (*DomElementNode, SelectorMap, error) {
+	var rootNode *DomElementNode
+	selectorMap := make(SelectorMap)
+	// the layout metrics of the target are the main frame's, same process frames are asked for their own
+	var frameViewport *ViewportInfo
+	if !frame.isMainFrame() && !frame.IsOOPIF {
+		out, err := frame.evaluate(frameViewportJs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("viewport of frame %s: %w", frame.FrameId, err)
+		}
+		frameViewport = new(ViewportInfo)
+		if err := json.Unmarshal(out, frameViewport); err != nil {
+			return nil, nil, err
+		}
+	}
+	err := chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		axNodes, err := getFullAXTree(ctx, cdp.FrameID(frame.FrameId))
+		if err != nil {
+			return err
+		}
+		if len(axNodes) == 0 {
+			return nil
+		}
+		var viewportInfo ViewportInfo
+		if frameViewport != nil {
+			viewportInfo = *frameViewport
+		} else {
+			_, _, _, _, viewport, _, err := page.GetLayoutMetrics().Do(ctx)
+			if err != nil {
+				return err
+			}
+			viewportInfo = ViewportInfo{
+				ScrollX: int(viewport.PageX),
+				ScrollY: int(viewport.PageY),
+				Width:   int(viewport.ClientWidth),
+				Height:  int(viewport.ClientHeight),
+			}
+		}
+		// boxes of same process frames are relative to the tab, make them relative to the frame
+		var origin Coordinates
+		if !frame.isMainFrame() && !frame.IsOOPIF {
+			owner, _, err := dom.GetFrameOwner(cdp.FrameID(frame.FrameId)).Do(ctx)
+			if err != nil {
+				return err
+			}
+			model, err := dom.GetBoxModel().WithBackendNodeID(owner).Do(ctx)
+			if err != nil {
+				return err
+			}
+			origin = Coordinates{X: int(math.Round(model.Content[0])), Y: int(math.Round(model.Content[1]))}
+		}
+		axMap := make(map[accessibility.NodeID]*accessibility.Node)
+		for _, n := range axNodes {
+			axMap[n.NodeID] = n
+		}
+		highlightIndex := highlightIndexStart
+		// box of the node in frame coordinates, false when it is not rendered
+		boxFn := func(backendNodeId cdp.BackendNodeID) (CoordinateSet, bool, bool) {
+			model, err := dom.GetBoxModel().WithBackendNodeID(backendNodeId).Do(ctx)
+			if err != nil || len(model.Content) < 8 {
+				return CoordinateSet{}, false, false
+			}
+			q := model.Content
+			point := func(x, y float64) Coordinates {
+				return Coordinates{X: int(math.Round(x)) - origin.X, Y: int(math.Round(y)) - origin.Y}
+			}
+			topLeft, bottomRight := point(q[0], q[1]), point(q[4], q[5])
+			inViewport := bottomRight.X > 0 && bottomRight.Y > 0 && topLeft.X < viewportInfo.Width && topLeft.Y < viewportInfo.Height
+			coords := CoordinateSet{
+				TopLeft:     topLeft,
+				TopRight:    point(q[2], q[3]),
+				BottomRight: bottomRight,
+				BottomLeft:  point(q[6], q[7]),
+				Width:       int(math.Round(q[2] - q[0])),
+				Height:      int(math.Round(q[5] - q[1])),
+			}
+			coords.Center = Coordinates{X: coords.TopLeft.X + coords.Width/2, Y: coords.TopLeft.Y + coords.Height/2}
+			return coords, true, inViewport
+		}
+		newElement := func(n *accessibility.Node, role string) *DomElementNode {
+			element := &DomElementNode{
+				TagName:       role,
+				Attributes:    make(map[string]string),
+				FrameId:       frame.FrameId,
+				BackendNodeId: int(n.BackendDOMNodeID),
+				ViewportInfo:  viewportInfo,
+			}
+			if domNode := domNodes[n.BackendDOMNodeID]; domNode != nil {
+				element.TagName = domNode.node.LocalName
+				element.XPath = domNode.xpath
+				for i := 0; i+1 < len(domNode.node.Attributes); i += 2 {
+					element.Attributes[domNode.node.Attributes[i]] = domNode.node.Attributes[i+1]
+				}
+				if domNode.node.FrameID != "" {
+					// link the frame tree below, as stampFrameOwner does for the script backend
+					element.Attributes[frameIdAttribute] = string(domNode.node.FrameID)
+				}
+			}
+			if coords, visible, inViewport := boxFn(n.BackendDOMNodeID); visible {
+				element.IsVisvable = true
+				element.IsTopElement = true
+				element.IsInViewPoint = inViewport
+				element.ViewportCoordinates = coords
+				element.PageCoordinates = coords
+				element.PageCoordinates.add(Coordinates{X: viewportInfo.ScrollX, Y: viewportInfo.ScrollY})
+			}
+			return element
+		}
+		var walkFn func(n *accessibility.Node, parent *DomElementNode)
+		walkFn = func(n *accessibility.Node, parent *DomElementNode) {
+			role := axString(n.Role)
+			switch {
+			case n.Ignored:
+				// children of ignored nodes are still exposed
+			case role == "StaticText":
+				if name := axString(n.Name); name != "" {
+					text := &DomTextNode{Text: name}
+					text.IsVisvable = true
+					text.SetParent(parent)
+					parent.Childrens = append(parent.Childrens, text)
+				}
+				return
+			case role == "Iframe":
+				element := newElement(n, role)
+				element.SetParent(parent)
+				parent.Childrens = append(parent.Childrens, element)
+				return
+			case axInteractiveRoles[role] || (axBool(n, accessibility.PropertyNameFocusable) && role != "RootWebArea"):
+				element := newElement(n, role)
+				element.IsInteractive = true
+				if element.IsVisvable && element.IsInViewPoint && !axBool(n, accessibility.PropertyNameDisabled) {
+					index := highlightIndex
+					highlightIndex++
+					element.HighlightIndex = &index
+					selectorMap[index] = element
+				}
+				element.SetParent(parent)
+				parent.Childrens = append(parent.Childrens, element)
+				for _, childId := range n.ChildIDs {
+					if child := axMap[childId]; child != nil {
+						walkFn(child, element)
+					}
+				}
+				setAxAttributes(element, n, role)
+				return
+			}
+			// other roles only structure the page, their children are kept
+			for _, childId := range n.ChildIDs {
+				if child := axMap[childId]; child != nil {
+					walkFn(child, parent)
+				}
+			}
+		}
+		root := axNodes[0]
+		for _, n := range axNodes {
+			if n.ParentID == "" {
+				root = n
+				break
+			}
+		}
+		rootNode = &DomElementNode{
+			TagName:      "html",
+			XPath:        "html",
+			Attributes:   make(map[string]string),
+			FrameId:      frame.FrameId,
+			ViewportInfo: viewportInfo,
+		}
+		rootNode.IsVisvable = true
+		walkFn(root, rootNode)
+		return nil
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return rootNode, selectorMap, nil
+}
+
+// the accessibility tree of the frame. ignored reasons and properties newer than cdproto fail to
+// decode, the nodes having them are decoded again without them instead of failing the whole tree
+func getFullAXTree(ctx context.Context, frameId cdp.FrameID) ([]*accessibility.Node, error) {
+	var res struct {
+		Nodes []jsontext.Value `json:"nodes"`
+	}
+	if err := cdp.Execute(ctx, accessibility.CommandGetFullAXTree, accessibility.GetFullAXTree().WithFrameID(frameId), &res); err != nil {
+		return nil, err
+	}
+	nodes := make([]*accessibility.Node, 0, len(res.Nodes))
+	for _, raw := range res.Nodes {
+		n := new(accessibility.Node)
+		if err := jsonv2.Unmarshal(raw, n); err == nil {
+			nodes = append(nodes, n)
+			continue
+		}
+		var fields map[string]jsontext.Value
+		if err := jsonv2.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		delete(fields, "ignoredReasons")
+		var properties []jsontext.Value
+		if err := jsonv2.Unmarshal(fields["properties"], &properties); err == nil {
+			known := make([]jsontext.Value, 0, len(properties))
+			for _, property := range properties {
+				if jsonv2.Unmarshal(property, new(accessibility.Property)) == nil {
+					known = append(known, property)
+				}
+			}
+			if fields["properties"], err = jsonv2.Marshal(known); err != nil {
+				return nil, err
+			}
+		}
+		data, err := jsonv2.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		n = new(accessibility.Node)
+		if err := jsonv2.Unmarshal(data, n); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// role, accessible name, value and states in the attributes the serializers show
+func setAxAttributes(element *DomElementNode, n *accessibility.Node, role string) {
+	if _, ok := element.Attributes["role"]; !ok && role != element.TagName {
+		element.Attributes["role"] = role
+	}
+	// the name is usually the text inside, only give it when it says more
+	if name := axString(n.Name); name != "" && name != element.getAllTextTillNextClickableElement(-1) {
+		if _, ok := element.Attributes["aria-label"]; !ok {
+			element.Attributes["aria-label"] = name
+		}
+	}
+	if value := axString(n.Value); value != "" {
+		element.Attributes["value"] = value
+	}
+	for _, property := range n.Properties {
+		name, ok := axStateAttributes[property.Name]
+		if !ok || property.Value == nil {
+			continue
+		}
+		if _, ok := element.Attributes[name]; !ok {
+			element.Attributes[name] = axString(property.Value)
+		}
+	}
+}
+
+func axString(v *accessibility.Value) string {
+	if v == nil || len(v.Value) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(v.Value, &s); err == nil {
+		return s
+	}
+	return string(v.Value)
+}
+
+func axBool(n *accessibility.Node, name accessibility.PropertyName) bool {
+	for _, property := range n.Properties {
+		if property.Name == name {
+			return axString(property.Value) == "true"
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package browser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/chromedp/cdproto/accessibility"
+	"github.com/chromedp/chromedp"
+)
+
+func axValue(raw string) *accessibility.Value {
+	return &accessibility.Value{Value: []byte(raw)}
+}
+
+func TestAxString(t *testing.T) {
+	tests := []struct {
+		value *accessibility.Value
+		want  string
+	}{
+		{nil, ""},
+		{&accessibility.Value{}, ""},
+		{axValue(`"Sign in"`), "Sign in"},
+		{axValue(`""`), ""},
+		{axValue(`true`), "true"},
+		{axValue(`"mixed"`), "mixed"},
+		{axValue(`42`), "42"},
+	}
+	for _, tt := range tests {
+		if got := axString(tt.value); got != tt.want {
+			t.Errorf("axString(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSetAxAttributes(t *testing.T) {
+	property := func(name accessibility.PropertyName, raw string) *accessibility.Property {
+		return &accessibility.Property{Name: name, Value: axValue(raw)}
+	}
+	tests := []struct {
+		name       string
+		tag        string
+		attributes map[string]string
+		text       string
+		node       *accessibility.Node
+		role       string
+		want       map[string]string
+	}{
+		{
+			name: "name is the text",
+			tag:  "button",
+			text: "Save",
+			node: &accessibility.Node{Name: axValue(`"Save"`)},
+			role: "button",
+			want: map[string]string{},
+		},
+		{
+			name: "name says more than the text",
+			tag:  "button",
+			text: "X",
+			node: &accessibility.Node{Name: axValue(`"Close dialog"`)},
+			role: "button",
+			want: map[string]string{"aria-label": "Close dialog"},
+		},
+		{
+			name:       "aria label of the page is kept",
+			tag:        "a",
+			attributes: map[string]string{"aria-label": "home"},
+			node:       &accessibility.Node{Name: axValue(`"Home page"`)},
+			role:       "link",
+			want:       map[string]string{"aria-label": "home", "role": "link"},
+		},
+		{
+			name:       "role differing from the tag",
+			tag:        "div",
+			attributes: map[string]string{"role": "tab"},
+			node:       &accessibility.Node{},
+			role:       "tab",
+			want:       map[string]string{"role": "tab"},
+		},
+		{
+			name: "value and states",
+			tag:  "input",
+			node: &accessibility.Node{
+				Value: axValue(`"alice"`),
+				Properties: []*accessibility.Property{
+					property(accessibility.PropertyNameRequired, `true`),
+					property(accessibility.PropertyNameExpanded, `false`),
+					property(accessibility.PropertyNameFocusable, `true`),
+					{Name: accessibility.PropertyNameChecked},
+				},
+			},
+			role: "combobox",
+			want: map[string]string{"role": "combobox", "value": "alice", "aria-required": "true", "aria-expanded": "false"},
+		},
+		{
+			name:       "states of the page are kept",
+			tag:        "button",
+			attributes: map[string]string{"aria-pressed": "mixed"},
+			node: &accessibility.Node{
+				Properties: []*accessibility.Property{property(accessibility.PropertyNamePressed, `"true"`)},
+			},
+			role: "button",
+			want: map[string]string{"aria-pressed": "mixed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			element := &DomElementNode{TagName: tt.tag, Attributes: make(map[string]string)}
+			for k, v := range tt.attributes {
+				element.Attributes[k] = v
+			}
+			if tt.text != "" {
+				text := &DomTextNode{Text: tt.text}
+				text.IsVisvable = true
+				text.SetParent(element)
+				element.Childrens = append(element.Childrens, text)
+			}
+			setAxAttributes(element, tt.node, tt.role)
+			if !reflect.DeepEqual(element.Attributes, tt.want) {
+				t.Errorf("attributes %v, want %v", element.Attributes, tt.want)
+			}
+		})
+	}
+}
+
+// the same process frame is scrolled, its own scroll and not the page's places the elements
+func TestAXTreeFrameScroll(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/frame" {
+			_, _ = w.Write([]byte(`<html><body style="margin:0">
+				<div style="height:1000px"></div>
+				<button id="inner" style="display:block;height:20px">inner</button>
+				<div style="height:280px"></div>
+				<button id="below" style="display:block;height:20px">below</button>
+				<div style="height:1000px"></div>
+			</body></html>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<html><body style="margin:0">
+			<button id="outer" style="display:block;height:20px">outer</button>
+			<iframe src="/frame" style="display:block;border:0;margin:30px 0 0 40px;width:300px;height:200px"></iframe>
+		</body></html>`))
+	}))
+	defer server.Close()
+	config := DefaultBrowserConfig()
+	config.DomBackend = DomBackendAccessibility
+	b := NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chromedp.Run(b.current, chromedp.Evaluate(`document.querySelector("iframe").contentWindow.scrollTo(0, 950)`, nil)); err != nil {
+		t.Fatal(err)
+	}
+	state, err := b.DomService.GetClickableElements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inner *DomElementNode
+	for _, node := range state.SelectorMap {
+		switch node.Attributes["id"] {
+		case "inner":
+			inner = node
+		case "below":
+			// in the viewport of the tab, below the one of the frame
+			t.Error("the button below the frame viewport is indexed")
+		}
+	}
+	if inner == nil {
+		t.Fatal("the button scrolled into the frame viewport is not indexed")
+	}
+	if v := inner.ViewportInfo; v.ScrollY != 950 || v.Width != 300 || v.Height != 200 {
+		t.Errorf("frame viewport %+v", v)
+	}
+	// the frame trees are shifted by the iframe at 40,50, the button border is 8,3 around its content
+	if got := inner.ViewportCoordinates.TopLeft; got.X != 48 || got.Y != 103 {
+		t.Errorf("viewport coordinates %+v", got)
+	}
+	if got := inner.PageCoordinates.TopLeft; got.X != 48 || got.Y != 1053 {
+		t.Errorf("page coordinates %+v", got)
+	}
+}
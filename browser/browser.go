@@ -2,12 +2,16 @@ package browser
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
+	"log/slog"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/chromedp/cdproto/input"
 	"github.com/chromedp/cdproto/page"
-	"github.com/chromedp/cdproto/target"
 	"github.com/chromedp/chromedp"
 	"lizhanpeng.org/lizhanpeng/agent/controller"
 )
@@ -21,6 +25,8 @@ type BrowserState struct {
 	ScreentShot []byte
 	PixelsAbove int
 	PixelBelow  int
+	// latest javascript errors and exceptions of the current tab
+	ConsoleErrors []*ConsoleMessage
 }
 
 type TabInfo struct {
@@ -32,41 +38,123 @@ type TabInfo struct {
 
 // one browser
 type Browser struct {
-	DomService  *DomService
-	ctx         context.Context   // root
-	current     context.Context   // current
-	tabs        []context.Context // recording all tabs, order by insert timestamp
-	CachedState *BrowserState     // get state in a loop
+	Config       *BrowserConfig
+	DomService   *DomService
+	ctx          context.Context                               // root
+	current      context.Context                               // current
+	tabs         []context.Context                             // recording all tabs, order by insert timestamp
+	frameTargets map[string]*frameTarget                       // attached out of process iframes, by target id
+	worlds       map[context.Context]map[string]*isolatedWorld // isolated worlds of in process iframes, by target and frame id
+	interceptor  *interceptor                                  // request interception of all tabs
+	policy       *DomainPolicy                                 // navigation domain guard, nil when every domain is allowed
+	har          *harRecorder                                  // network recording of all tabs, nil when off
+	consoles     map[context.Context]*consoleBuffer            // console messages by tab
+	cancel       context.CancelFunc                            // stops the browser process
+	CachedState  *BrowserState                                 // get state in a loop
+	Logger       *slog.Logger                                  // action records and chromedp logs, discarded by default
+	// secrets typed by InputText in place of their <secret>name</secret> placeholders
+	SensitiveData controller.SensitiveData
 }
 
 func NewBrowser() *Browser {
+	return NewBrowserWithConfig(DefaultBrowserConfig())
+}
+
+func NewBrowserWithConfig(config *BrowserConfig) *Browser {
 	b := new(Browser)
+	b.Config = config
+	b.Logger = config.Logger
+	if b.Logger == nil {
+		b.Logger = controller.DiscardLogger()
+	}
 	b.DomService = NewDomService(b)
+	b.policy = NewDomainPolicy(config.AllowedDomains, config.DeniedDomains)
+	if config.HarPath != "" {
+		b.har = newHarRecorder(config.HarContent, config.HarMaxBodySize)
+	}
 	return b
 }
 
-func (b *Browser) newChromeDpContext() context.Context {
+func (b *Browser) newChromeDpContext() (context.Context, error) {
 	parent := b.ctx
+	var contextOpts []chromedp.ContextOption
 	if b.ctx == nil {
+		contextOpts = b.chromedpLogOptions()
 		opts := chromedp.DefaultExecAllocatorOptions[3:]
 		opts = append(opts, chromedp.NoFirstRun, chromedp.NoDefaultBrowserCheck)
-		ctx, _ := chromedp.NewExecAllocator(context.Background(), opts...)
+		if b.Config.Headless {
+			opts = append(opts, chromedp.Headless)
+		}
+		ctx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
+		b.cancel = cancel
 		parent = ctx
 	}
-	ctx, _ := chromedp.NewContext(parent)
+	ctx, _ := chromedp.NewContext(parent, contextOpts...)
 	if b.ctx == nil {
 		b.ctx = ctx
+		b.listenTargets()
 	}
 	b.current = ctx
 	b.tabs = append(b.tabs, ctx)
-	return ctx
+	if err := b.setupTab(ctx); err != nil {
+		return nil, err
+	}
+	return ctx, nil
 }
 
-func (b *Browser) getCurrentPage() context.Context {
+// close the browser, the HAR file is written first when configured
+func (b *Browser) Close() error {
 	if b.ctx == nil {
-		b.newChromeDpContext()
+		return nil
+	}
+	var err error
+	if b.har != nil && b.Config.HarPath != "" {
+		err = b.SaveHar(b.Config.HarPath)
+	}
+	if stopErr := b.stop(); stopErr != nil && err == nil {
+		err = stopErr
 	}
-	return b.current
+	return err
+}
+
+// stop chrome and forget its tabs
+func (b *Browser) stop() error {
+	err := chromedp.Cancel(b.ctx)
+	b.cancel()
+	b.ctx = nil
+	b.current = nil
+	b.tabs = nil
+	b.frameTargets = nil
+	b.worlds = nil
+	return err
+}
+
+// start chrome and load the storage state of the config. without Start the browser starts with
+// the first action, and a storage state that can not be loaded is only logged
+func (b *Browser) Start() error {
+	if b.ctx != nil {
+		return nil
+	}
+	if _, err := b.newChromeDpContext(); err != nil {
+		// a later action starts chrome again
+		_ = b.stop()
+		return fmt.Errorf("start chrome: %w", err)
+	}
+	if b.Config.StorageStatePath != "" {
+		if err := b.LoadStorageState(b.Config.StorageStatePath); err != nil {
+			return fmt.Errorf("load storage state: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *Browser) getCurrentPage() (context.Context, error) {
+	if b.ctx == nil {
+		if err := b.Start(); err != nil {
+			return nil, err
+		}
+	}
+	return b.current, nil
 }
 
 func (b *Browser) GetState() *BrowserState {
@@ -76,22 +164,60 @@ func (b *Browser) GetState() *BrowserState {
 	return b.CachedState
 }
 
-func (b *Browser) UpdateState() {
-	b.DomService.RemoveHightLights()
-	domState := b.DomService.GetClickableElements()
-	screentShot := b.Screenshot()
+// read the state of the current tab into CachedState, the cached state is kept on an error
+func (b *Browser) UpdateState() error {
+	var domState *DomState
+	var elements SelectorMap
+	var err error
+	if b.Config.AnnotateScreenshot {
+		// nothing is drawn into the page
+		domState, err = b.DomService.Snapshot()
+		if domState != nil {
+			elements = domState.SelectorMap
+		}
+	} else {
+		b.DomService.RemoveHightLights()
+		domState, err = b.DomService.GetClickableElements()
+	}
+	if err != nil {
+		return err
+	}
+	screentShot, err := b.screenshot(b.Config.Screenshot, elements)
+	if err != nil {
+		b.Logger.Warn("state screenshot", "error", err)
+	}
 	scrollAbove, scrollBelow := b.GetScrollInfo()
-	tabs, tab := b.getTabsInfo()
+	tabs, tab, err := b.getTabsInfo()
+	if err != nil {
+		return err
+	}
+	if b.CachedState != nil && b.CachedState.Url == tab.Url {
+		// on another page every element would be new
+		markNewElements(&b.CachedState.DomState, domState)
+	}
 	state := &BrowserState{
-		DomState:    *domState,
-		Url:         tab.Url,
-		Title:       tab.Title,
-		Tabs:        tabs,
-		ScreentShot: screentShot,
-		PixelsAbove: scrollAbove,
-		PixelBelow:  scrollBelow,
+		DomState:      *domState,
+		Url:           tab.Url,
+		Title:         tab.Title,
+		Tabs:          tabs,
+		ScreentShot:   screentShot,
+		PixelsAbove:   scrollAbove,
+		PixelBelow:    scrollBelow,
+		ConsoleErrors: b.GetConsoleErrors(b.Config.StateConsoleErrors),
 	}
 	b.CachedState = state
+	return nil
+}
+
+// the elements of the state in the configured format
+func (b *Browser) SerializeElements(state *BrowserState) (string, error) {
+	if state.ElemmentTree == nil {
+		return "", nil
+	}
+	if b.Config.DomSerializer == nil {
+		return state.ElemmentTree.GetCliableElementsString()
+	}
+	return b.Config.DomSerializer.Serialize(state.ElemmentTree)
 }
 
 func (b *Browser) getSelectorMap() SelectorMap {
@@ -101,11 +227,11 @@ func (b *Browser) getSelectorMap() SelectorMap {
 	return b.CachedState.SelectorMap
 }
 
-func (b *Browser) getTabsInfo() ([]*TabInfo, *TabInfo) {
+func (b *Browser) getTabsInfo() ([]*TabInfo, *TabInfo, error) {
 	ret := make([]*TabInfo, 0)
 	tabInfos, err := chromedp.Targets(b.current)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
 	mp := make(map[string]*TabInfo)
 	for _, tab := range tabInfos {
@@ -123,7 +249,11 @@ func (b *Browser) getTabsInfo() ([]*TabInfo, *TabInfo) {
 	for i, tab := range b.tabs {
 		id := chromedp.FromContext(tab).Target.TargetID.String()
 		if mp[id] == nil {
-			panic("tab not found")
+			if id == currentId {
+				return nil, nil, fmt.Errorf("the current tab %s is closed", id)
+			}
+			// a popup closed by the domain policy after it was attached
+			continue
 		}
 		info := &TabInfo{
 			TargetId: mp[id].TargetId,
@@ -136,14 +266,14 @@ func (b *Browser) getTabsInfo() ([]*TabInfo, *TabInfo) {
 			currentTabInfo = info
 		}
 	}
-	return ret, currentTabInfo
+	return ret, currentTabInfo, nil
 }
 
-func (b *Browser) getChromeDpTabs() map[string]*TabInfo {
+func (b *Browser) getChromeDpTabs() (map[string]*TabInfo, error) {
 	ret := make(map[string]*TabInfo)
 	tabInfos, err := chromedp.Targets(b.current)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	for _, tab := range tabInfos {
 		if tab.Type != "page" {
@@ -156,91 +286,138 @@ func (b *Browser) getChromeDpTabs() map[string]*TabInfo {
 		}
 		ret[string(tab.TargetID)] = info
 	}
-	return ret
+	return ret, nil
 }
 
-func (b *Browser) newPage() context.Context {
+func (b *Browser) newPage() (context.Context, error) {
+	if b.ctx == nil {
+		if err := b.Start(); err != nil {
+			return nil, err
+		}
+	}
 	return b.newChromeDpContext()
 }
 
 // TODO: how to pass 「im not a robot」testing
-func (b *Browser) GoogleSearch(param *GoogleSearchActionParam) {
-	ctx := b.getCurrentPage()
+func (b *Browser) GoogleSearch(param *GoogleSearchActionParam) (err error) {
+	defer b.logAction("search_google", param, time.Now(), &err)
+	searchUrl := fmt.Sprintf("https://www.google.com/search?q=%s&udm=14", url.QueryEscape(param.Query))
+	if err := b.checkNavigation(searchUrl); err != nil {
+		return err
+	}
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
 	tasks := chromedp.Tasks{
-		chromedp.Navigate(fmt.Sprint("https://www.google.com/search?q=%s&udm=14", param.Query)),
+		chromedp.Navigate(searchUrl),
 	}
-	chromedp.Run(ctx, tasks...)
+	return chromedp.Run(ctx, tasks...)
 }
 
-func (b *Browser) GoToUrlInCurrentTab(param *GoToUrlInCurrentTabParam) {
-	ctx := b.getCurrentPage()
+// a *NavigationPolicyError is returned when the domain is refused, redirects to refused domains are blocked
+func (b *Browser) GoToUrlInCurrentTab(param *GoToUrlInCurrentTabParam) (err error) {
+	defer b.logAction("go_to_url", param, time.Now(), &err)
+	if err := b.checkNavigation(param.Url); err != nil {
+		return err
+	}
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	count := b.policy.violationCount()
 	tasks := chromedp.Tasks{
 		chromedp.Navigate(param.Url),
 	}
-	chromedp.Run(ctx, tasks...)
+	runErr := chromedp.Run(ctx, tasks...)
+	if err := b.policyViolationSince(count); err != nil {
+		// the blocked navigation fails too, the policy error tells why
+		return err
+	}
+	return runErr
 }
 
-func (b *Browser) GoToUelrlNewTab(param *GoToUrlNewTabParam) {
-	ctx := b.newPage()
+func (b *Browser) GoToUelrlNewTab(param *GoToUrlNewTabParam) (err error) {
+	defer b.logAction("open_tab", param, time.Now(), &err)
+	if err := b.checkNavigation(param.Url); err != nil {
+		return err
+	}
+	ctx, err := b.newPage()
+	if err != nil {
+		return err
+	}
+	count := b.policy.violationCount()
 	tasks := chromedp.Tasks{
 		chromedp.Navigate(param.Url),
 	}
-	chromedp.Run(ctx, tasks...)
+	runErr := chromedp.Run(ctx, tasks...)
+	if err := b.policyViolationSince(count); err != nil {
+		// the blocked navigation fails too, the policy error tells why
+		return err
+	}
+	return runErr
 }
 
-func (b *Browser) GoBackward() {
-	ctx := b.getCurrentPage()
+func (b *Browser) GoBackward() (err error) {
+	defer b.logAction("go_back", nil, time.Now(), &err)
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
 	tasks := chromedp.Tasks{
 		chromedp.NavigateBack(),
 	}
-	chromedp.Run(ctx, tasks...)
+	return chromedp.Run(ctx, tasks...)
 }
 
-func (b *Browser) GoForward() {
-	ctx := b.getCurrentPage()
+func (b *Browser) GoForward() (err error) {
+	defer b.logAction("go_forward", nil, time.Now(), &err)
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
 	tasks := chromedp.Tasks{
 		chromedp.NavigateForward(),
 	}
-	chromedp.Run(ctx, tasks...)
+	return chromedp.Run(ctx, tasks...)
 }
 
-func (b *Browser) CloseCurrentTab() {
-	ctx := b.getCurrentPage()
+// close the current tab and switch to the first one, a new tab is opened when it was the last
+func (b *Browser) CloseCurrentTab() (err error) {
+	defer b.logAction("close_tab", nil, time.Now(), &err)
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
 	tasks := chromedp.Tasks{
 		page.Close(),
 	}
-	pageId := chromedp.FromContext(ctx).Target.TargetID.String()
-	pageIndex := -1
-	for i, tab := range b.tabs {
-		target := chromedp.FromContext(tab).Target
-		if target == nil {
-			continue
-		}
-		if target.TargetID.String() == pageId {
-			pageIndex = i
-			break
-		}
+	if err := chromedp.Run(ctx, tasks...); err != nil {
+		return err
 	}
-	if pageIndex >= 0 {
-		var tabs []context.Context
-		if pageIndex > 0 {
-			tabs = append(tabs, b.tabs[:pageIndex]...)
-		}
-		if pageIndex < len(b.tabs)-1 {
-			tabs = append(tabs, b.tabs[pageIndex+1:]...)
+	var tabs []context.Context
+	for _, tab := range b.tabs {
+		if tab != ctx {
+			tabs = append(tabs, tab)
 		}
 	}
-	chromedp.Run(ctx, tasks...)
-	b.SwithTab(&SwitchTabParam{
+	b.tabs = tabs
+	delete(b.consoles, ctx)
+	delete(b.worlds, ctx)
+	if len(b.tabs) == 0 {
+		_, err := b.newChromeDpContext()
+		return err
+	}
+	return b.SwithTab(&SwitchTabParam{
 		PageIndex: 0,
 	})
 }
 
-func (b *Browser) SwithTab(param *SwitchTabParam) {
-	if param.PageIndex >= len(b.tabs) {
-		return
-	} else if param.PageIndex < -1 {
-		return
+// switch to the tab with the index, -1 is the last tab
+func (b *Browser) SwithTab(param *SwitchTabParam) (err error) {
+	defer b.logAction("switch_tab", param, time.Now(), &err)
+	if param.PageIndex >= len(b.tabs) || param.PageIndex < -1 || len(b.tabs) == 0 {
+		return fmt.Errorf("no tab %d, %d tabs are open", param.PageIndex, len(b.tabs))
 	}
 	var ctx context.Context
 	if param.PageIndex == -1 {
@@ -252,115 +429,272 @@ func (b *Browser) SwithTab(param *SwitchTabParam) {
 	tasks := chromedp.Tasks{
 		page.BringToFront(),
 	}
-	chromedp.Run(ctx, tasks...)
+	return chromedp.Run(ctx, tasks...)
 }
 
+// screenshot with the configured options, nil when it fails
 func (b *Browser) Screenshot() []byte {
-	var out []byte
-	ctx := b.getCurrentPage()
-	tasks := chromedp.Tasks{
-		chromedp.FullScreenshot(&out, 90),
+	out, err := b.TakeScreenshot(b.Config.Screenshot)
+	if err != nil {
+		b.Logger.Warn("screenshot", "error", err)
+		return nil
 	}
-	chromedp.Run(ctx, tasks...)
-	// os.WriteFile("/tmp/snap.jpeg", out, 0777)
 	return out
 }
 
-func (b *Browser) ExecJavascript(param *ExecJavascriptParam) []byte {
+func (b *Browser) ExecJavascript(param *ExecJavascriptParam) ([]byte, error) {
 	var out []byte
-	var valOut []byte
-	ctx := b.getCurrentPage()
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return nil, err
+	}
 	tasks := chromedp.Tasks{
-		chromedp.Evaluate("1+1", &valOut),
 		chromedp.Evaluate(param.Content, &out), // execute js to highlight elements
 	}
-	chromedp.Run(ctx, tasks...)
-	if string(valOut) != "2" {
-		panic("javascript not work")
+	if err := chromedp.Run(ctx, tasks...); err != nil {
+		return nil, err
 	}
-	return out
+	return out, nil
 }
 
 func (b *Browser) Wait(param *WaitScondsParam) {
+	var err error
+	defer b.logAction("wait", param, time.Now(), &err)
 	time.Sleep(time.Duration(param.Seconds) * time.Second)
 }
 
-func (b *Browser) GetClickElements() *DomState {
+// poll until the element with the selector is visible and the text is on the page
+func (b *Browser) WaitFor(param *WaitForParam) (err error) {
+	defer b.logAction("wait_for", param, time.Now(), &err)
+	if param.Selector == "" && param.Text == "" {
+		return errors.New("wait_for needs a selector or a text")
+	}
+	timeout := time.Duration(param.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	conditions := make([]string, 0, 2)
+	if param.Selector != "" {
+		conditions = append(conditions, fmt.Sprintf(`(() => {
+			const e = document.querySelector(%s);
+			if (!e) return false;
+			const r = e.getBoundingClientRect();
+			return r.width > 0 && r.height > 0;
+		})()`, JsString(param.Selector)))
+	}
+	if param.Text != "" {
+		conditions = append(conditions, fmt.Sprintf(`!!document.body && document.body.innerText.includes(%s)`, JsString(param.Text)))
+	}
+	expression := strings.Join(conditions, " && ")
+	deadline := time.Now().Add(timeout)
+	for {
+		out, err := b.ExecJavascript(&ExecJavascriptParam{Content: expression})
+		if err == nil && string(out) == "true" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for selector %q text %q", timeout, param.Selector, param.Text)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// text of the elements matching the selector, one per line, or of the whole page
+func (b *Browser) Extract(param *ExtractParam) (result *controller.ActionResult, err error) {
+	defer b.logAction("extract", param, time.Now(), &err)
+	expression := `document.body ? document.body.innerText : ""`
+	if param.Selector != "" {
+		expression = fmt.Sprintf(`Array.from(document.querySelectorAll(%s), e => e.innerText).join("\n")`, JsString(param.Selector))
+	}
+	out, err := b.ExecJavascript(&ExecJavascriptParam{Content: expression})
+	if err != nil {
+		return nil, err
+	}
+	var text string
+	if err := json.Unmarshal(out, &text); err != nil {
+		return nil, err
+	}
+	return &controller.ActionResult{
+		ExtractedContent: text,
+		IncludeInMemory:  true,
+	}, nil
+}
+
+func (b *Browser) GetClickElements() (*DomState, error) {
 	return b.DomService.GetClickableElements()
 }
 
 func (b *Browser) GetScrollInfo() (int, int) {
-	scrollYStr := b.ExecJavascript(&ExecJavascriptParam{
-		Content: "window.scrollY",
-	})
-	viewPortHeightStr := b.ExecJavascript(&ExecJavascriptParam{
-		Content: "window.innerHeight",
-	})
-	totalHeightStr := b.ExecJavascript(&ExecJavascriptParam{
-		Content: "document.documentElement.scrollHeight",
+	out, err := b.ExecJavascript(&ExecJavascriptParam{
+		Content: "[window.scrollY, window.innerHeight, document.documentElement.scrollHeight]",
 	})
-	scrollY, _ := strconv.Atoi(string(scrollYStr))
-	viewPortHeight, _ := strconv.Atoi(string(viewPortHeightStr))
-	totalHeight, _ := strconv.Atoi(string(totalHeightStr))
+	if err != nil {
+		return 0, 0
+	}
+	var info []float64
+	if err := json.Unmarshal(out, &info); err != nil || len(info) != 3 {
+		return 0, 0
+	}
+	scrollY, viewPortHeight, totalHeight := int(info[0]), int(info[1]), int(info[2])
 	return scrollY, totalHeight - (scrollY + viewPortHeight)
 }
 
-func (b *Browser) ClickElement(param *ClickElementParam) {
-	smp := b.getSelectorMap()
-	if smp == nil {
-		return
-	}
-	node := smp[param.Index]
-	if node == nil {
-		return
+// a *StaleElementError is returned when the element is gone,
+// a *NavigationPolicyError when the click navigated to a refused domain
+func (b *Browser) ClickElement(param *ClickElementParam) (err error) {
+	defer b.logAction("click_element", param, time.Now(), &err)
+	click := func() error {
+		frame, backendNodeId, err := b.locateSelector(param.Selector)
+		if err != nil {
+			return err
+		}
+		return b.clickBackendNode(frame, backendNodeId)
 	}
-	ctx := b.getCurrentPage()
-	tasks := chromedp.Tasks{
-		// chromedp.ScrollIntoView(node.XPath, chromedp.BySearch),
-		// will wait until is visable
-		chromedp.Click(node.XPath, chromedp.BySearch),
-	}
-	chromedp.Run(ctx, tasks...)
-	// todo 跳转到新的tab？
-	tabs := b.getChromeDpTabs()
-	if len(tabs) == len(b.tabs) {
-		// no new tabs opened
-		// pass
-	} else if len(tabs) == len(b.tabs)+1 {
-		// open new tab
-		for _, c := range b.tabs {
-			id := chromedp.FromContext(c).Target.TargetID.String()
-			delete(tabs, id)
+	if param.Selector == "" {
+		node, err := b.getIndexElement(param.Index)
+		if err != nil {
+			return err
 		}
-		if len(tabs) != 1 {
-			panic("not supported to be here")
+		click = func() error {
+			return b.clickNode(node)
 		}
-		for id, _ := range tabs {
-			nCtx, _ := chromedp.NewContext(b.ctx, chromedp.WithTargetID(target.ID(id)))
-			b.tabs = append(b.tabs, nCtx)
+	}
+	count := b.policy.violationCount()
+	if err := click(); err != nil {
+		return err
+	}
+	// switch to the tab the click opened
+	attached, err := b.attachNewTabs()
+	if err != nil {
+		// a popup refused meanwhile can not be set up, the policy error tells why
+		if e := b.policyViolationSince(count); e != nil {
+			return e
 		}
-		b.SwithTab(&SwitchTabParam{
+		return err
+	}
+	if len(attached) > 0 {
+		if err := b.SwithTab(&SwitchTabParam{
 			PageIndex: -1,
-		})
-	} else {
-		panic("not supposed to be here")
+		}); err != nil {
+			return err
+		}
 	}
+	return b.policyViolationSince(count)
 }
 
-func (b *Browser) InputText(param *InputTextParam) {
-	smp := b.getSelectorMap()
-	if smp == nil {
-		return
+func (b *Browser) ClickAt(param *ClickAtParam) (err error) {
+	defer b.logAction("click_at", param, time.Now(), &err)
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
 	}
-	node := smp[param.Index]
-	if node == nil {
-		return
+	tasks := chromedp.Tasks{
+		chromedp.MouseClickXY(float64(param.X), float64(param.Y)),
+	}
+	return chromedp.Run(ctx, tasks...)
+}
+
+func (b *Browser) Hover(param *HoverElementParam) (err error) {
+	defer b.logAction("hover_element", param, time.Now(), &err)
+	x, y, err := b.getIndexCenter(param.Index)
+	if err != nil {
+		return err
+	}
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	tasks := chromedp.Tasks{
+		chromedp.MouseEvent(input.MouseMoved, x, y),
+	}
+	return chromedp.Run(ctx, tasks...)
+}
+
+func (b *Browser) DoubleClick(param *DoubleClickElementParam) (err error) {
+	defer b.logAction("double_click_element", param, time.Now(), &err)
+	x, y, err := b.getIndexCenter(param.Index)
+	if err != nil {
+		return err
+	}
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
 	}
-	ctx := b.getCurrentPage()
 	tasks := chromedp.Tasks{
-		chromedp.SendKeys(node.XPath, param.Input, chromedp.BySearch),
+		chromedp.MouseClickXY(x, y),
+		chromedp.MouseClickXY(x, y, chromedp.ClickCount(2)),
 	}
-	chromedp.Run(ctx, tasks...)
+	return chromedp.Run(ctx, tasks...)
+}
+
+func (b *Browser) RightClick(param *RightClickElementParam) (err error) {
+	defer b.logAction("right_click_element", param, time.Now(), &err)
+	x, y, err := b.getIndexCenter(param.Index)
+	if err != nil {
+		return err
+	}
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	tasks := chromedp.Tasks{
+		chromedp.MouseClickXY(x, y, chromedp.ButtonRight),
+	}
+	return chromedp.Run(ctx, tasks...)
+}
+
+// drag from the source element to the target element, or by an offset when no target is given
+func (b *Browser) DragAndDrop(param *DragAndDropParam) (err error) {
+	defer b.logAction("drag_and_drop", param, time.Now(), &err)
+	fromX, fromY, err := b.getIndexCenter(param.SourceIndex)
+	if err != nil {
+		return err
+	}
+	toX, toY := fromX+float64(param.OffsetX), fromY+float64(param.OffsetY)
+	if param.TargetIndex != nil {
+		toX, toY, err = b.getIndexCenter(*param.TargetIndex)
+		if err != nil {
+			return err
+		}
+	}
+	// left button held down while moving
+	holding := func(p *input.DispatchMouseEventParams) *input.DispatchMouseEventParams {
+		return p.WithButton(input.Left).WithButtons(1)
+	}
+	tasks := chromedp.Tasks{
+		chromedp.MouseEvent(input.MouseMoved, fromX, fromY),
+		chromedp.MouseEvent(input.MousePressed, fromX, fromY, holding, chromedp.ClickCount(1)),
+	}
+	// move in steps, sliders and sortable lists ignore a single jump
+	const steps = 10
+	for i := 1; i <= steps; i++ {
+		x := fromX + (toX-fromX)*float64(i)/steps
+		y := fromY + (toY-fromY)*float64(i)/steps
+		tasks = append(tasks, chromedp.MouseEvent(input.MouseMoved, x, y, holding))
+	}
+	tasks = append(tasks, chromedp.MouseEvent(input.MouseReleased, toX, toY, chromedp.ButtonLeft, chromedp.ClickCount(1)))
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(ctx, tasks...)
+}
+
+func (b *Browser) InputText(param *InputTextParam) (err error) {
+	defer b.logAction("input_text", param, time.Now(), &err)
+	text := b.SensitiveData.Replace(param.Input)
+	if param.Selector != "" {
+		frame, backendNodeId, err := b.locateSelector(param.Selector)
+		if err != nil {
+			return err
+		}
+		return b.inputBackendNode(frame, backendNodeId, text)
+	}
+	node, err := b.getIndexElement(param.Index)
+	if err != nil {
+		return err
+	}
+	return b.inputNode(node, text)
 }
 
 // input parameters
@@ -388,20 +722,102 @@ type WaitScondsParam struct {
 	Seconds int
 }
 
+type WaitForParam struct {
+	Selector string // css selector of an element that has to be visible
+	Text     string // text that has to be on the page
+	Timeout  int    // seconds, 10 when 0
+}
+
+type ExtractParam struct {
+	Selector string // css selector, the whole page when empty
+}
+
 type ClickElementParam struct {
-	Index int
+	Index    int
+	Selector string // css selector used instead of the index when given, for scripts
 }
 type InputTextParam struct {
+	Index    int
+	Selector string // css selector used instead of the index when given, for scripts
+	Input    string
+}
+
+type ClickAtParam struct {
+	X int
+	Y int
+}
+
+type HoverElementParam struct {
+	Index int
+}
+
+type DoubleClickElementParam struct {
 	Index int
-	Input string
+}
+
+type RightClickElementParam struct {
+	Index int
+}
+
+type DragAndDropParam struct {
+	SourceIndex int
+	TargetIndex *int
+	OffsetX     int
+	OffsetY     int
+}
+
+// handler of an action that only succeeds or fails
+func handler[P any](fn func(b *Browser, param *P) error) controller.ActionHandler {
+	return resultHandler(func(b *Browser, param *P) (*controller.ActionResult, error) {
+		return nil, fn(b, param)
+	})
+}
+
+func resultHandler[P any](fn func(b *Browser, param *P) (*controller.ActionResult, error)) controller.ActionHandler {
+	return func(executor any, params any) (*controller.ActionResult, error) {
+		b, ok := executor.(*Browser)
+		if !ok {
+			return nil, fmt.Errorf("browser actions run on a *Browser, not %T", executor)
+		}
+		param, _ := params.(*P)
+		return fn(b, param)
+	}
 }
 
 func init() {
-	controller.RegistryAction("wait", "Wait for x seconds default 3", new(WaitScondsParam))
-	controller.RegistryAction("search_google", "'Search the query in Google in the current tab, the query should be a search query like humans search in Google, concrete and not vague or super long. More the single most important items.", new(GoogleSearchActionParam))
-	controller.RegistryAction("go_to_url", "Navigate to URL in the current tab", new(GoToUrlInCurrentTabParam))
-	controller.RegistryAction("go_back", "Go back", nil)
-	controller.RegistryAction("go_forward", "Go Forward", nil)
-	controller.RegistryAction("switch_tab", "Switch tab", new(SwitchTabParam))
-	controller.RegistryAction("open_tab", "Open url in new tab", new(GoToUrlNewTabParam))
+	controller.RegistryAction("wait", "Wait for x seconds default 3", new(WaitScondsParam), handler(func(b *Browser, param *WaitScondsParam) error {
+		b.Wait(param)
+		return nil
+	}))
+	controller.RegistryAction("search_google", "'Search the query in Google in the current tab, the query should be a search query like humans search in Google, concrete and not vague or super long. More the single most important items.", new(GoogleSearchActionParam), handler((*Browser).GoogleSearch))
+	controller.RegistryAction("go_to_url", "Navigate to URL in the current tab", new(GoToUrlInCurrentTabParam), handler((*Browser).GoToUrlInCurrentTab))
+	controller.RegistryAction("go_back", "Go back", nil, handler(func(b *Browser, _ *struct{}) error {
+		return b.GoBackward()
+	}))
+	controller.RegistryAction("go_forward", "Go Forward", nil, handler(func(b *Browser, _ *struct{}) error {
+		return b.GoForward()
+	}))
+	controller.RegistryAction("switch_tab", "Switch tab", new(SwitchTabParam), handler((*Browser).SwithTab))
+	controller.RegistryAction("open_tab", "Open url in new tab", new(GoToUrlNewTabParam), handler((*Browser).GoToUelrlNewTab))
+	controller.RegistryAction("click_element", "Click the element with index", new(ClickElementParam), handler((*Browser).ClickElement))
+	controller.RegistryAction("input_text", "Input text into the input element with index", new(InputTextParam), handler((*Browser).InputText))
+	controller.RegistryAction("wait_for", "Wait until the element with the css selector is visible and the text is on the page, at most timeout seconds default 10", new(WaitForParam), handler((*Browser).WaitFor))
+	controller.RegistryAction("extract", "Extract the text of the elements with the css selector, or of the whole page", new(ExtractParam), resultHandler((*Browser).Extract))
+	controller.RegistryAction("click_at", "Click at x,y viewport coordinates, for canvas based apps", new(ClickAtParam), handler((*Browser).ClickAt))
+	controller.RegistryAction("hover_element", "Move the mouse over the element with index", new(HoverElementParam), handler((*Browser).Hover))
+	controller.RegistryAction("double_click_element", "Double click the element with index", new(DoubleClickElementParam), handler((*Browser).DoubleClick))
+	controller.RegistryAction("right_click_element", "Right click the element with index to open its context menu", new(RightClickElementParam), handler((*Browser).RightClick))
+	controller.RegistryAction("screenshot", "Save a screenshot of the viewport, the full page or the element with index to a file in the workspace", new(ScreenshotParam), resultHandler(func(b *Browser, param *ScreenshotParam) (*controller.ActionResult, error) {
+		path, err := b.SaveScreenshot(param)
+		if err != nil {
+			return nil, err
+		}
+		return &controller.ActionResult{
+			ExtractedContent: fmt.Sprintf("Saved the screenshot to %s", path),
+			IncludeInMemory:  true,
+			Attachments:      []string{path},
+		}, nil
+	}))
+	controller.RegistryAction("save_pdf", "Save the current page as a pdf file in the workspace, to archive receipts or reports", new(SaveAsPDFParam), resultHandler((*Browser).SaveAsPDF))
+	controller.RegistryAction("drag_and_drop", "Drag the element with source index onto the element with target index, or by offset x,y pixels when no target index is given", new(DragAndDropParam), handler((*Browser).DragAndDrop))
 }
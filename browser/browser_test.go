@@ -0,0 +1,55 @@
+package browser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCloseAndSwitchTabs(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body>` + r.URL.Path + `</body></html>`))
+	}))
+	defer server.Close()
+	b := NewBrowser()
+	defer b.Close()
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL + "/first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.GoToUelrlNewTab(&GoToUrlNewTabParam{Url: server.URL + "/second"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SwithTab(&SwitchTabParam{PageIndex: 2}); err == nil {
+		t.Error("switched to a tab that is not open")
+	}
+	if err := b.SwithTab(&SwitchTabParam{PageIndex: -1}); err != nil {
+		t.Fatal(err)
+	}
+	second := b.current
+	if err := b.CloseCurrentTab(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.tabs) != 1 || b.current != b.tabs[0] {
+		t.Fatalf("%d tabs after closing one", len(b.tabs))
+	}
+	if _, ok := b.consoles[second]; ok {
+		t.Error("the console buffer of the closed tab is kept")
+	}
+	tabs, current, err := b.getTabsInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tabs) != 1 || current.Url != server.URL+"/first" {
+		t.Errorf("tabs %d, current %s", len(tabs), current.Url)
+	}
+	if err := b.GoBackward(); err != nil {
+		t.Error(err)
+	}
+	if err := b.GoForward(); err != nil {
+		t.Error(err)
+	}
+}
@@ -4,10 +4,14 @@
     focusHighlightIndex: -1,
     viewportExpansion: 0,
     debugMode: false,
+    processIframes: true,
+    highlightIndexStart: 0,
   }
 ) => {
   const { doHighlightElements, focusHighlightIndex, viewportExpansion, debugMode } = args;
-  let highlightIndex = 0; // Reset highlight index
+  // When disabled, iframes are left empty and the caller extracts each frame separately
+  const processIframes = args.processIframes ?? true;
+  let highlightIndex = args.highlightIndexStart ?? 0; // Reset highlight index
 
   // Add timing stack to handle recursion
   const TIMING_STACK = {
@@ -185,6 +189,11 @@
 
   const ID = { current: 0 };
 
+  /**
+   * Highlighted elements ordered by highlight index, so the caller can resolve their backend node ids.
+   */
+  const HIGHLIGHTED_ELEMENTS = [];
+
   const HIGHLIGHT_CONTAINER_ID = "playwright-highlight-container";
 
   /**
@@ -332,6 +341,36 @@
     }
   }
 
+  /**
+   * Returns the viewport and page coordinates of an element, rounded to whole pixels.
+   */
+  function getCoordinates(element) {
+    const rect = getCachedBoundingRect(element);
+    if (!rect) return null;
+
+    const round = Math.round;
+    const coordinateSet = (left, top) => ({
+      topLeft: { x: round(left), y: round(top) },
+      topRight: { x: round(left + rect.width), y: round(top) },
+      bottomLeft: { x: round(left), y: round(top + rect.height) },
+      bottomRight: { x: round(left + rect.width), y: round(top + rect.height) },
+      center: { x: round(left + rect.width / 2), y: round(top + rect.height / 2) },
+      width: round(rect.width),
+      height: round(rect.height),
+    });
+
+    return {
+      viewportCoordinates: coordinateSet(rect.left, rect.top),
+      pageCoordinates: coordinateSet(rect.left + window.scrollX, rect.top + window.scrollY),
+      viewport: {
+        scrollX: round(window.scrollX),
+        scrollY: round(window.scrollY),
+        width: window.innerWidth,
+        height: window.innerHeight,
+      },
+    };
+  }
+
   /**
    * Returns an XPath tree string for an element.
    */
@@ -908,6 +947,7 @@
           if (nodeData.isInteractive) {
             nodeData.isInViewport = true;
             nodeData.highlightIndex = highlightIndex++;
+            HIGHLIGHTED_ELEMENTS.push(node);
 
             if (doHighlightElements) {
               if (focusHighlightIndex >= 0) {
@@ -923,22 +963,29 @@
       }
     }
 
+    // Coordinates of interactive elements, and of iframes to offset the frame contents
+    if (nodeData.highlightIndex !== undefined || nodeData.tagName === 'iframe') {
+      Object.assign(nodeData, getCoordinates(node));
+    }
+
     // Process children, with special handling for iframes and rich text editors
     if (node.tagName) {
       const tagName = node.tagName.toLowerCase();
 
       // Handle iframes
       if (tagName === "iframe") {
-        try {
-          const iframeDoc = node.contentDocument || node.contentWindow?.document;
-          if (iframeDoc) {
-            for (const child of iframeDoc.childNodes) {
-              const domElement = buildDomTree(child, node);
-              if (domElement) nodeData.children.push(domElement);
+        if (processIframes) {
+          try {
+            const iframeDoc = node.contentDocument || node.contentWindow?.document;
+            if (iframeDoc) {
+              for (const child of iframeDoc.childNodes) {
+                const domElement = buildDomTree(child, node);
+                if (domElement) nodeData.children.push(domElement);
+              }
             }
+          } catch (e) {
+            console.warn("Unable to access iframe:", e);
           }
-        } catch (e) {
-          console.warn("Unable to access iframe:", e);
         }
       }
       // Handle rich text editors and contenteditable elements
@@ -1050,6 +1097,6 @@
   }
 
   return debugMode ?
-    { rootId, map: DOM_HASH_MAP, perfMetrics: PERF_METRICS } :
-    { rootId, map: DOM_HASH_MAP };
+    { rootId, map: DOM_HASH_MAP, elements: HIGHLIGHTED_ELEMENTS, perfMetrics: PERF_METRICS } :
+    { rootId, map: DOM_HASH_MAP, elements: HIGHLIGHTED_ELEMENTS };
 }
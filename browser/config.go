@@ -0,0 +1,39 @@
+package browser
+
+import "log/slog"
+
+// browser options
+type BrowserConfig struct {
+	Headless         bool             // run chrome without a window
+	StorageStatePath string           // storage state file loaded when the browser starts, see SaveStorageState
+	InterceptRules   []*InterceptRule // requests blocked or rewritten, interception is on when rules are given
+	HarPath          string           // record the network of all tabs and write a HAR file there at Close
+	HarContent       bool             // include response bodies in the HAR file
+	HarMaxBodySize   int              // bodies larger than this many bytes are left out, 0 for no limit
+	// navigation guard, a domain also matches its subdomains and globs like *.example.com are supported.
+	// denied domains take precedence, an empty allowlist allows every domain that is not denied
+	AllowedDomains []string
+	DeniedDomains  []string
+	// how the dom state is built, DomBackendScript when empty, DomBackendAccessibility or DomBackendSnapshot
+	DomBackend string
+	// the state screenshot, DefaultScreenshotOptions when nil
+	Screenshot *ScreenshotOptions
+	// directory of the files actions save, like screenshots, the working directory when empty
+	WorkspaceDir string
+	// draw the element boxes and indices on the state screenshot in go instead of into the page
+	AnnotateScreenshot bool
+	// format of the elements given to the model, the compact format when nil
+	DomSerializer DomSerializer
+	// structured logs of actions, dom extraction and chromedp, discarded when nil
+	Logger *slog.Logger
+	// console messages kept per tab, and errors of them reported in BrowserState
+	ConsoleBufferSize  int
+	StateConsoleErrors int
+}
+
+func DefaultBrowserConfig() *BrowserConfig {
+	return &BrowserConfig{
+		ConsoleBufferSize:  100,
+		StateConsoleErrors: 10,
+	}
+}
@@ -0,0 +1,165 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// console output or uncaught exception of a page
+type ConsoleMessage struct {
+	Type      string // log, info, warning, error, ..., or exception
+	Text      string
+	Url       string
+	Line      int
+	Timestamp time.Time
+}
+
+func (m *ConsoleMessage) IsError() bool {
+	return m.Type == "error" || m.Type == "assert" || m.Type == "exception"
+}
+
+func (m *ConsoleMessage) String() string {
+	if m.Url == "" {
+		return fmt.Sprintf("[%s] %s", m.Type, m.Text)
+	}
+	return fmt.Sprintf("[%s] %s (%s:%d)", m.Type, m.Text, m.Url, m.Line)
+}
+
+// ring buffer keeping the latest console messages of one tab
+type consoleBuffer struct {
+	mu       sync.Mutex
+	messages []*ConsoleMessage
+	next     int
+	full     bool
+}
+
+const defaultConsoleBufferSize = 100
+
+func newConsoleBuffer(size int) *consoleBuffer {
+	if size <= 0 {
+		size = defaultConsoleBufferSize
+	}
+	return &consoleBuffer{
+		messages: make([]*ConsoleMessage, size),
+	}
+}
+
+func (c *consoleBuffer) add(m *ConsoleMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.messages) == 0 {
+		return
+	}
+	c.messages[c.next] = m
+	c.next = (c.next + 1) % len(c.messages)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// messages from the oldest to the latest
+func (c *consoleBuffer) list() []*ConsoleMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ret := make([]*ConsoleMessage, 0, len(c.messages))
+	if c.full {
+		ret = append(ret, c.messages[c.next:]...)
+	}
+	ret = append(ret, c.messages[:c.next]...)
+	return ret
+}
+
+func (b *Browser) listenConsole(tab context.Context) {
+	if b.consoles == nil {
+		b.consoles = make(map[context.Context]*consoleBuffer)
+	}
+	buffer := newConsoleBuffer(b.Config.ConsoleBufferSize)
+	b.consoles[tab] = buffer
+	chromedp.ListenTarget(tab, func(ev any) {
+		switch ev := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			m := &ConsoleMessage{
+				Type: string(ev.Type),
+				Text: consoleArgsText(ev.Args),
+			}
+			if ev.Timestamp != nil {
+				m.Timestamp = ev.Timestamp.Time()
+			}
+			if ev.StackTrace != nil && len(ev.StackTrace.CallFrames) > 0 {
+				frame := ev.StackTrace.CallFrames[0]
+				m.Url = frame.URL
+				m.Line = int(frame.LineNumber) + 1
+			}
+			buffer.add(m)
+		case *runtime.EventExceptionThrown:
+			details := ev.ExceptionDetails
+			text := details.Text
+			if details.Exception != nil && details.Exception.Description != "" {
+				text = details.Exception.Description
+			}
+			m := &ConsoleMessage{
+				Type: "exception",
+				Text: text,
+				Url:  details.URL,
+				Line: int(details.LineNumber) + 1,
+			}
+			if ev.Timestamp != nil {
+				m.Timestamp = ev.Timestamp.Time()
+			}
+			buffer.add(m)
+		}
+	})
+}
+
+// console messages of the current tab, oldest first
+func (b *Browser) GetConsoleMessages() []*ConsoleMessage {
+	// no tab without a started browser, and no messages
+	buffer := b.consoles[b.current]
+	if buffer == nil {
+		return nil
+	}
+	return buffer.list()
+}
+
+// latest errors and exceptions of the current tab, at most limit
+func (b *Browser) GetConsoleErrors(limit int) []*ConsoleMessage {
+	errors := make([]*ConsoleMessage, 0)
+	for _, m := range b.GetConsoleMessages() {
+		if m.IsError() {
+			errors = append(errors, m)
+		}
+	}
+	if limit >= 0 && len(errors) > limit {
+		errors = errors[len(errors)-limit:]
+	}
+	return errors
+}
+
+func consoleArgsText(args []*runtime.RemoteObject) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case len(arg.Value) > 0:
+			var s string
+			if err := json.Unmarshal(arg.Value, &s); err == nil {
+				parts = append(parts, s)
+			} else {
+				parts = append(parts, string(arg.Value))
+			}
+		case arg.UnserializableValue != "":
+			parts = append(parts, string(arg.UnserializableValue))
+		case arg.Description != "":
+			parts = append(parts, arg.Description)
+		default:
+			parts = append(parts, string(arg.Type))
+		}
+	}
+	return strings.Join(parts, " ")
+}
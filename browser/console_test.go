@@ -0,0 +1,84 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/cdproto/runtime"
+)
+
+func consoleTexts(messages []*ConsoleMessage) string {
+	texts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		texts = append(texts, m.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestConsoleBuffer(t *testing.T) {
+	tests := []struct {
+		size  int
+		added int
+		want  string
+	}{
+		{size: 3, added: 0, want: ""},
+		{size: 3, added: 2, want: "0 1"},
+		{size: 3, added: 3, want: "0 1 2"},
+		{size: 3, added: 4, want: "1 2 3"},
+		{size: 3, added: 7, want: "4 5 6"},
+		{size: 1, added: 2, want: "1"},
+	}
+	for _, tt := range tests {
+		c := newConsoleBuffer(tt.size)
+		for i := 0; i < tt.added; i++ {
+			c.add(&ConsoleMessage{Type: "log", Text: fmt.Sprint(i)})
+		}
+		if got := consoleTexts(c.list()); got != tt.want {
+			t.Errorf("size %d, %d added: %q, want %q", tt.size, tt.added, got, tt.want)
+		}
+	}
+	if c := newConsoleBuffer(0); len(c.messages) != defaultConsoleBufferSize {
+		t.Errorf("default size %d", len(c.messages))
+	}
+}
+
+func TestConsoleErrors(t *testing.T) {
+	tab := context.Background()
+	buffer := newConsoleBuffer(10)
+	for i, typ := range []string{"log", "error", "warning", "exception", "assert", "info"} {
+		buffer.add(&ConsoleMessage{Type: typ, Text: fmt.Sprint(i)})
+	}
+	b := NewBrowser()
+	if messages := b.GetConsoleMessages(); messages != nil {
+		t.Errorf("messages without a tab %v", messages)
+	}
+	b.current = tab
+	b.consoles = map[context.Context]*consoleBuffer{tab: buffer}
+	for _, tt := range []struct {
+		limit int
+		want  string
+	}{
+		{limit: -1, want: "1 3 4"},
+		{limit: 2, want: "3 4"},
+		{limit: 0, want: ""},
+	} {
+		if got := consoleTexts(b.GetConsoleErrors(tt.limit)); got != tt.want {
+			t.Errorf("limit %d: %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestConsoleArgsText(t *testing.T) {
+	args := []*runtime.RemoteObject{
+		{Type: "string", Value: []byte(`"hello"`)},
+		{Type: "number", Value: []byte(`42`)},
+		{Type: "number", UnserializableValue: "NaN"},
+		{Type: "object", Description: "Array(2)"},
+		{Type: "undefined"},
+	}
+	if got := consoleArgsText(args); got != "hello 42 NaN Array(2) undefined" {
+		t.Errorf("text %q", got)
+	}
+}
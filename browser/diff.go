@@ -0,0 +1,65 @@
+package browser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// attributes identifying an element across page states, values that change on input are left out
+var hashAttributes = []string{"id", "name", "type", "role", "href", "aria-label", "placeholder", "title", "alt"}
+
+// stable hash of the element from its tag, xpath, key attributes and the tags of its ancestors,
+// it stays the same when the element is rendered again at the same place
+func (d *DomElementNode) Hash() string {
+	if d.hash != "" {
+		return d.hash
+	}
+	parents := make([]string, 0)
+	for p := d.Parent; p != nil; p = p.Parent {
+		parents = append(parents, p.TagName)
+	}
+	h := sha256.New()
+	h.Write([]byte(d.TagName + "\n" + d.XPath + "\n" + strings.Join(parents, "/") + "\n"))
+	for _, key := range hashAttributes {
+		if val, ok := d.Attributes[key]; ok {
+			h.Write([]byte(key + "=" + val + "\n"))
+		}
+	}
+	d.hash = hex.EncodeToString(h.Sum(nil))[:16]
+	return d.hash
+}
+
+// hash of the element's tag, key attributes, own text and xpath, used to check at action time
+// that an index still points at the element the model has seen. class, style and state attributes
+// are left out, they change on focus and hover
+func (d *DomElementNode) IdentityHash() string {
+	if d.identityHash != "" {
+		return d.identityHash
+	}
+	h := sha256.New()
+	h.Write([]byte(d.TagName + "\n" + d.XPath + "\n"))
+	for _, key := range hashAttributes {
+		if val, ok := d.Attributes[key]; ok {
+			h.Write([]byte(key + "=" + val + "\n"))
+		}
+	}
+	h.Write([]byte(d.getAllTextTillNextClickableElement(-1)))
+	d.identityHash = hex.EncodeToString(h.Sum(nil))[:16]
+	return d.identityHash
+}
+
+// flag the interactive elements of current that were not in previous, e.g. a dropdown that opened.
+// nothing is flagged without a previous state
+func markNewElements(previous *DomState, current *DomState) {
+	if previous == nil || current == nil {
+		return
+	}
+	known := make(map[string]bool, len(previous.SelectorMap))
+	for _, node := range previous.SelectorMap {
+		known[node.Hash()] = true
+	}
+	for _, node := range current.SelectorMap {
+		node.IsNew = !known[node.Hash()]
+	}
+}
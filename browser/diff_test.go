@@ -0,0 +1,128 @@
+package browser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newButton(attributes map[string]string, text string) *DomElementNode {
+	node := &DomElementNode{
+		TagName:    "button",
+		XPath:      "html/body/div/button[2]",
+		Attributes: attributes,
+	}
+	node.Childrens = []DomNodeI{&DomTextNode{Text: text}}
+	return node
+}
+
+func TestIdentityHashIgnoresStateAttributes(t *testing.T) {
+	base := newButton(map[string]string{"id": "save", "type": "submit", "class": "btn"}, "Save")
+	same := []*DomElementNode{
+		newButton(map[string]string{"id": "save", "type": "submit", "class": "btn btn-focused"}, "Save"),
+		newButton(map[string]string{"id": "save", "type": "submit", "class": "btn", "style": "outline: 1px"}, "Save"),
+		newButton(map[string]string{"id": "save", "type": "submit", "class": "btn", "aria-expanded": "true"}, "Save"),
+		newButton(map[string]string{"id": "save", "type": "submit", "browser-user-highlight-id": "playwright-highlight-3"}, "Save"),
+	}
+	for _, node := range same {
+		if node.IdentityHash() != base.IdentityHash() {
+			t.Errorf("attributes %v change the identity", node.Attributes)
+		}
+	}
+	different := []*DomElementNode{
+		newButton(map[string]string{"id": "cancel", "type": "submit"}, "Save"),
+		newButton(map[string]string{"id": "save", "type": "button"}, "Save"),
+		newButton(map[string]string{"id": "save", "type": "submit", "aria-label": "save draft"}, "Save"),
+		newButton(map[string]string{"id": "save", "type": "submit"}, "Delete"),
+	}
+	for _, node := range different {
+		if node.IdentityHash() == base.IdentityHash() {
+			t.Errorf("attributes %v and text keep the identity", node.Attributes)
+		}
+	}
+}
+
+func TestLiveNodeMatches(t *testing.T) {
+	node := newButton(map[string]string{"id": "save", "type": "submit", "class": "btn"}, "Save")
+	tests := []struct {
+		name string
+		live liveNode
+		want bool
+	}{
+		{"same element", liveNode{true, "button", map[string]string{"id": "save", "type": "submit"}}, true},
+		{"detached", liveNode{false, "button", map[string]string{"id": "save", "type": "submit"}}, false},
+		{"other tag", liveNode{true, "a", map[string]string{"id": "save", "type": "submit"}}, false},
+		{"changed id", liveNode{true, "button", map[string]string{"id": "delete", "type": "submit"}}, false},
+		{"key attribute added", liveNode{true, "button", map[string]string{"id": "save", "type": "submit", "title": "Save"}}, false},
+		{"key attribute removed", liveNode{true, "button", map[string]string{"id": "save"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.live.matches(node); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// a state with a menu button, a link and the given dropdown options, indexed in document order
+func newMenuState(options ...string) *DomState {
+	body := &DomElementNode{TagName: "body", XPath: "html/body"}
+	state := &DomState{ElemmentTree: body, SelectorMap: make(SelectorMap)}
+	add := func(tag string, xpath string, attributes map[string]string, text string) {
+		index := len(state.SelectorMap)
+		node := &DomElementNode{TagName: tag, XPath: xpath, Attributes: attributes, HighlightIndex: &index}
+		node.Parent = body
+		node.Childrens = []DomNodeI{&DomTextNode{Text: text, DomNode: DomNode{IsVisvable: true, Parent: node}}}
+		body.Childrens = append(body.Childrens, node)
+		state.SelectorMap[index] = node
+	}
+	add("button", "html/body/button", map[string]string{"id": "menu", "class": "open"}, "Menu")
+	for i, option := range options {
+		add("a", fmt.Sprintf("html/body/ul/li[%d]/a", i+1), map[string]string{"href": "/" + option}, option)
+	}
+	add("a", "html/body/footer/a", map[string]string{"href": "/help"}, "Help")
+	return state
+}
+
+func TestMarkNewElements(t *testing.T) {
+	serialize := func(state *DomState) string {
+		return mustSerialize(t, &CompactSerializer{DefaultSerializeOptions()}, state.ElemmentTree)
+	}
+	closed := newMenuState()
+	markNewElements(nil, closed)
+	if got := serialize(closed); strings.Contains(got, "*") {
+		t.Errorf("elements of the first state are new:\n%s", got)
+	}
+
+	// the dropdown opened, the indices of the elements after it moved
+	opened := newMenuState("home", "about")
+	opened.SelectorMap[0].Attributes["class"] = "open active"
+	markNewElements(closed, opened)
+	want := "[0]<button Menu/>\n" +
+		"*[1]<a home/>\n" +
+		"*[2]<a about/>\n" +
+		"[3]<a Help/>"
+	if got := serialize(opened); got != want {
+		t.Errorf("opened:\n%s\nwant:\n%s", got, want)
+	}
+
+	// nothing changed since the previous state, the marks are cleared
+	again := newMenuState("home", "about")
+	for _, node := range again.SelectorMap {
+		node.IsNew = true
+	}
+	markNewElements(opened, again)
+	if got := serialize(again); strings.Contains(got, "*") {
+		t.Errorf("elements of an unchanged state are new:\n%s", got)
+	}
+
+	// one option replaced by another
+	changed := newMenuState("home", "contact")
+	markNewElements(again, changed)
+	for index, node := range changed.SelectorMap {
+		if node.IsNew != (index == 2) {
+			t.Errorf("element %d new = %v", index, node.IsNew)
+		}
+	}
+}
@@ -1,14 +1,23 @@
 package browser
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
 )
 
 type DomService struct {
 	Browser *Browser
+	Logger  *slog.Logger
+	frames  []*frameContext // frames of the last extraction, main frame first
 }
 
 type DomState struct {
@@ -19,6 +28,7 @@ type DomState struct {
 func NewDomService(b *Browser) *DomService {
 	d := new(DomService)
 	d.Browser = b
+	d.Logger = b.Logger
 	return d
 }
 
@@ -27,6 +37,8 @@ type domJsParam struct {
 	FocusHighlightIndex int  `json:"focusHighlightIndex"`
 	ViewportExpansion   int  `json:"viewportExpansion"`
 	DebugMode           bool `json:"debugMode"`
+	ProcessIframes      bool `json:"processIframes"`
+	HighlightIndexStart int  `json:"highlightIndexStart"`
 }
 
 func (p *domJsParam) String() string {
@@ -34,33 +46,190 @@ func (p *domJsParam) String() string {
 	return string(d)
 }
 
-func (d *DomService) AddHightlights() []byte {
+func (d *DomService) AddHightlights(frame *frameContext, highlightIndexStart int) ([]byte, []cdp.BackendNodeID, error) {
+	return d.buildDomTree(frame, highlightIndexStart, true)
+}
+
+func (d *DomService) buildDomTree(frame *frameContext, highlightIndexStart int, doHighlight bool) ([]byte, []cdp.BackendNodeID, error) {
 	param := &domJsParam{
-		DoHighlightElements: true,
+		DoHighlightElements: doHighlight,
 		FocusHighlightIndex: -1,
 		ViewportExpansion:   0,
 		DebugMode:           false,
+		ProcessIframes:      false, // every frame is extracted on its own
+		HighlightIndexStart: highlightIndexStart,
 	}
 	content := fmt.Sprintf(`(%s)(%s)`, domJs, param.String())
-	out := d.Browser.ExecJavascript(&ExecJavascriptParam{
-		Content: content,
-	})
-	return out
+	return frame.evaluateDomTree(content)
 }
 
 func (d *DomService) RemoveHightLights() {
-	_ = d.Browser.ExecJavascript(&ExecJavascriptParam{
-		Content: removeHighlightJs,
-	})
+	if backend := d.Browser.Config.DomBackend; backend == DomBackendAccessibility || backend == DomBackendSnapshot {
+		// nothing is drawn
+		return
+	}
+	if len(d.frames) == 0 {
+		_, _ = d.Browser.ExecJavascript(&ExecJavascriptParam{
+			Content: removeHighlightJs,
+		})
+		return
+	}
+	for _, frame := range d.frames {
+		// frames may be gone since the last extraction
+		if _, err := frame.evaluate(removeHighlightJs); err != nil {
+			d.Logger.Debug("remove highlights", "frame", frame.FrameId, "error", err)
+		}
+	}
+}
+
+func (d *DomService) GetClickableElements() (*DomState, error) {
+	return d.extract(true, true)
+}
+
+// the current dom state without drawing highlights
+func (d *DomService) Snapshot() (*DomState, error) {
+	return d.extract(false, true)
+}
+
+// the current dom state to verify elements at action time, the frames of the last state are kept
+// for the actions on it
+func (d *DomService) probe() (*DomState, error) {
+	return d.extract(false, false)
 }
 
-func (d *DomService) GetClickableElements() *DomState {
-	out := d.AddHightlights()
-	rootNode, sMap := ConstructDomTree(out)
+func (d *DomService) extract(doHighlight bool, keepFrames bool) (*DomState, error) {
+	began := time.Now()
+	frames, err := d.Browser.getFrames()
+	if err != nil {
+		return nil, fmt.Errorf("collect frames: %w", err)
+	}
+	if keepFrames {
+		d.frames = frames
+	}
+	backend := d.Browser.Config.DomBackend
+	frameMap := make(map[string]*frameContext)
+	for _, frame := range frames {
+		frameMap[frame.FrameId] = frame
+	}
+	// owners must be stamped before their documents are extracted
+	if backend == DomBackendScript || backend == "" {
+		stamped := make([]*frameContext, 0)
+		for _, frame := range frames {
+			if parent := frameMap[frame.ParentId]; parent != nil {
+				if err := stampFrameOwner(parent, frame.FrameId); err != nil {
+					d.Logger.Debug("stamp frame owner", "frame", frame.FrameId, "error", err)
+					continue
+				}
+				stamped = append(stamped, frame)
+			}
+		}
+		// the stamps are only needed to read the trees, leave the page as it was
+		defer func() {
+			for _, frame := range stamped {
+				if err := unstampFrameOwner(frameMap[frame.ParentId], frame.FrameId); err != nil {
+					d.Logger.Debug("unstamp frame owner", "frame", frame.FrameId, "error", err)
+				}
+			}
+		}()
+	}
+	// dom nodes and snapshots are fetched once per target
+	domNodes := make(map[context.Context]map[cdp.BackendNodeID]*axDomNode)
+	snapshots := make(map[context.Context]*domSnapshot)
+	var rootNode *DomElementNode
+	selectorMap := make(SelectorMap)
+	frameRoots := make(map[string]*DomElementNode)
+	for _, frame := range frames {
+		start := len(selectorMap)
+		var root *DomElementNode
+		var sMap SelectorMap
+		var err error
+		switch backend {
+		case DomBackendAccessibility:
+			if domNodes[frame.ctx] == nil {
+				domNodes[frame.ctx], err = getAxDomNodes(frame.ctx)
+			}
+			if err == nil {
+				root, sMap, err = d.buildAXTree(frame, start, domNodes[frame.ctx])
+			}
+		case DomBackendSnapshot:
+			if snapshots[frame.ctx] == nil {
+				snapshots[frame.ctx], err = captureDomSnapshot(frame.ctx)
+			}
+			if err == nil {
+				root, sMap, err = d.buildSnapshotTree(frame, start, snapshots[frame.ctx])
+			}
+		default:
+			root, sMap, err = d.buildScriptTree(frame, start, doHighlight)
+		}
+		if err != nil {
+			if frame.isMainFrame() {
+				return nil, fmt.Errorf("extract the main frame: %w", err)
+			}
+			// a frame can be detached or still loading, skip it
+			d.Logger.Warn("skip frame", "frame", frame.FrameId, "backend", backend, "error", err)
+			continue
+		}
+		if root == nil {
+			continue
+		}
+		for i, node := range sMap {
+			selectorMap[i] = node
+		}
+		frameRoots[frame.FrameId] = root
+		if frame.isMainFrame() {
+			rootNode = root
+		}
+	}
+	// link every frame tree below the iframe element owning it
+	for _, root := range frameRoots {
+		root.walk(func(node *DomElementNode) {
+			frameId, ok := node.Attributes[frameIdAttribute]
+			if !ok {
+				return
+			}
+			delete(node.Attributes, frameIdAttribute)
+			if child := frameRoots[frameId]; child != nil {
+				// frame coordinates are relative to the iframe, make them relative to the owner's document
+				child.offsetCoordinates(node.ViewportCoordinates.TopLeft, node.PageCoordinates.TopLeft)
+				child.SetParent(node)
+				node.Childrens = append(node.Childrens, child)
+			}
+		})
+	}
+	d.Logger.Debug("dom extracted", "backend", backend, "frames", len(frameRoots), "elements", len(selectorMap), "duration", time.Since(began))
 	return &DomState{
 		ElemmentTree: rootNode,
-		SelectorMap:  sMap,
+		SelectorMap:  selectorMap,
+	}, nil
+}
+
+// run buildDomTree.js in the frame, interactive elements get indices from highlightIndexStart
+func (d *DomService) buildScriptTree(frame *frameContext, highlightIndexStart int, doHighlight bool) (*DomElementNode, SelectorMap, error) {
+	out, backendNodeIds, err := d.buildDomTree(frame, highlightIndexStart, doHighlight)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, sMap, err := ConstructDomTree(out)
+	if err != nil || root == nil {
+		return nil, nil, err
+	}
+	root.setFrameId(frame.FrameId)
+	for i, backendNodeId := range backendNodeIds {
+		if node := sMap[highlightIndexStart+i]; node != nil {
+			node.BackendNodeId = int(backendNodeId)
+		}
 	}
+	return root, sMap, nil
+}
+
+// find the frame by id from the last extraction
+func (d *DomService) getFrame(frameId string) *frameContext {
+	for _, frame := range d.frames {
+		if frame.FrameId == frameId {
+			return frame
+		}
+	}
+	return nil
 }
 
 type Coordinates struct {
@@ -78,6 +247,22 @@ type CoordinateSet struct {
 	Height      int
 }
 
+func (c Coordinates) add(offset Coordinates) Coordinates {
+	return Coordinates{X: c.X + offset.X, Y: c.Y + offset.Y}
+}
+
+func (c *CoordinateSet) add(offset Coordinates) {
+	c.TopLeft = c.TopLeft.add(offset)
+	c.TopRight = c.TopRight.add(offset)
+	c.BottomLeft = c.BottomLeft.add(offset)
+	c.BottomRight = c.BottomRight.add(offset)
+	c.Center = c.Center.add(offset)
+}
+
+func (c *CoordinateSet) IsEmpty() bool {
+	return c.Width == 0 && c.Height == 0
+}
+
 type ViewportInfo struct {
 	ScrollX int
 	ScrollY int
@@ -118,19 +303,52 @@ type DomElementNode struct {
 	TagName             string            `json:"tagName"`
 	XPath               string            `json:"xpath"`
 	Attributes          map[string]string `json:"attributes"`
-	IsInteractive       bool              `json:"isVisible"`
+	IsInteractive       bool              `json:"isInteractive"`
 	IsTopElement        bool              `json:"isTopElement"`
 	IsInViewPoint       bool              `json:"isInViewport"`
 	ShadowRoot          bool              `json:"shadowRoot"`
 	HighlightIndex      *int              `json:"highlightIndex"`
-	ViewportCoordinates CoordinateSet     `json:"-"`
-	PageCoordinates     CoordinateSet     `json:"-"`
+	FrameId             string            `json:"frameId"`
+	BackendNodeId       int               `json:"backendNodeId"`
+	ViewportCoordinates CoordinateSet     `json:"viewportCoordinates"`
+	PageCoordinates     CoordinateSet     `json:"pageCoordinates"`
 	ViewportInfo        ViewportInfo      `json:"viewport"`
 	ChildrenIDs         []string          `json:"children"`
 	Childrens           []DomNodeI
+	IsNew               bool // appeared since the previous state of the same page
+	hash                string
+	identityHash        string
 	DomNode
 }
 
+// set the frame id on the element and its descendants of the same document
+func (d *DomElementNode) setFrameId(frameId string) {
+	d.walk(func(node *DomElementNode) {
+		node.FrameId = frameId
+	})
+}
+
+// visit the element and all element descendants, parents first
+func (d *DomElementNode) walk(fn func(node *DomElementNode)) {
+	fn(d)
+	for _, child := range d.Childrens {
+		if eNode, ok := child.(*DomElementNode); ok {
+			eNode.walk(fn)
+		}
+	}
+}
+
+// shift the coordinates of the element and its descendants
+func (d *DomElementNode) offsetCoordinates(viewportOffset Coordinates, pageOffset Coordinates) {
+	d.walk(func(node *DomElementNode) {
+		if node.ViewportCoordinates.IsEmpty() {
+			return
+		}
+		node.ViewportCoordinates.add(viewportOffset)
+		node.PageCoordinates.add(pageOffset)
+	})
+}
+
 type DomTree struct {
 	RootId int                 `json:"rootId"`
 	Map    map[string]DomNodeI `json:"map"`
@@ -138,60 +356,10 @@ type DomTree struct {
 
 type SelectorMap = map[int]*DomElementNode
 
-func (d *DomElementNode) GetCliableElementsString() string {
-	includeAttributes := map[string]bool{
-		"title":         true,
-		"type":          true,
-		"name":          true,
-		"role":          true,
-		"tabindex":      true,
-		"aria-label":    true,
-		"placeholder":   true,
-		"value":         true,
-		"alt":           true,
-		"aria-expanded": true,
-	}
-	formatedStrs := make([]string, 0)
-	var processFn func(node DomNodeI, depth int)
-	processFn = func(node DomNodeI, depth int) {
-		if eNode, ok := node.(*DomElementNode); ok {
-			if eNode.HighlightIndex != nil {
-				attributes := make([]string, 0)
-				text := d.getAllTextTillNextClickableElement(-1)
-				for key, val := range eNode.Attributes {
-					if !includeAttributes[key] {
-						continue
-					} else if val == eNode.TagName {
-						continue
-					}
-					attributes = append(attributes, val)
-				}
-				line := fmt.Sprintf("[%d]<%s ", *eNode.HighlightIndex, eNode.TagName)
-				attributesStr := strings.Join(attributes, ";")
-				if attributesStr != "" {
-					line += fmt.Sprintf("{%s}", attributesStr)
-				}
-				if text != "" {
-					if attributesStr != "" {
-						line += fmt.Sprintf(">%s", text)
-					} else {
-						line += text
-					}
-				}
-				line += "/>"
-				formatedStrs = append(formatedStrs, line)
-			}
-			for _, child := range eNode.Childrens {
-				processFn(child, depth+1)
-			}
-		} else if tNode, ok := node.(*DomTextNode); ok {
-			if tNode.IsVisvable && !tNode.hasParentWithHighlight() {
-				formatedStrs = append(formatedStrs, tNode.Text)
-			}
-		}
-	}
-	processFn(d, 0)
-	return strings.Join(formatedStrs, "\n")
+// the elements in the compact format with the default options, see DomSerializer for others
+func (d *DomElementNode) GetCliableElementsString() (string, error) {
+	s := &CompactSerializer{DefaultSerializeOptions()}
+	return s.Serialize(d)
 }
 
 func (d *DomElementNode) getAllTextTillNextClickableElement(maxDepth int) string {
@@ -216,76 +384,116 @@ func (d *DomElementNode) getAllTextTillNextClickableElement(maxDepth int) string
 	return strings.Trim(strings.Join(textParts, "\n"), " ")
 }
 
-func ParseDomNode(mp map[string]any) DomNodeI {
-	if mp == nil {
-		return nil
-	}
-	data, err := json.Marshal(mp)
-	if err != nil {
-		panic(err)
+// parse one node of the buildDomTree.js payload, text nodes have type TEXT_NODE and elements a tag name
+func ParseDomNode(data json.RawMessage) (DomNodeI, error) {
+	kind := struct {
+		Type    *string `json:"type"`
+		TagName string  `json:"tagName"`
+	}{}
+	if err := json.Unmarshal(data, &kind); err != nil {
+		return nil, err
 	}
 	var out DomNodeI
-	if mp["type"] == "TEXT_NODE" {
+	switch {
+	case kind.Type != nil && *kind.Type == "TEXT_NODE":
 		out = new(DomTextNode)
-	} else {
+	case kind.Type != nil:
+		return nil, fmt.Errorf("unknown node type %q", *kind.Type)
+	case kind.TagName != "":
 		out = new(DomElementNode)
+	default:
+		return nil, errors.New("node has neither a type nor a tag name")
 	}
 	if err := json.Unmarshal(data, out); err != nil {
-		panic(err)
+		return nil, err
 	}
-	return out
+	return out, nil
 }
 
-func ConstructDomTree(data []byte) (*DomElementNode, SelectorMap) {
+type domTreePayload struct {
+	RootId *string                    `json:"rootId"`
+	Map    map[string]json.RawMessage `json:"map"`
+}
+
+// build the tree from the buildDomTree.js payload in two passes, every node is parsed first,
+// then children are linked from the root in payload order. a nil root means the body was rejected
+func ConstructDomTree(data []byte) (*DomElementNode, SelectorMap, error) {
 	if len(data) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
-	mp := make(map[string]any)
-	if err := json.Unmarshal(data, &mp); err != nil {
-		panic(err)
+	payload := new(domTreePayload)
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, nil, fmt.Errorf("invalid dom tree payload: %w", err)
 	}
-	selectorMap := make(SelectorMap)
-	nodeMap := make(map[string]DomNodeI)
-	for id, data := range mp["map"].(map[string]any) {
-		node := ParseDomNode(data.(map[string]any))
+	if payload.RootId == nil {
+		return nil, nil, nil
+	}
+	// sorted, so the same payload always gives the same error
+	ids := make([]string, 0, len(payload.Map))
+	for id := range payload.Map {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	nodeMap := make(map[string]DomNodeI, len(payload.Map))
+	for _, id := range ids {
+		node, err := ParseDomNode(payload.Map[id])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid node %s: %w", id, err)
+		}
 		nodeMap[id] = node
-		if _, ok := node.(*DomTextNode); ok {
-			// pass
-		} else if elementNode, ok := node.(*DomElementNode); ok {
-			if elementNode.HighlightIndex != nil {
-				selectorMap[*elementNode.HighlightIndex] = elementNode
+	}
+	rootNode, ok := nodeMap[*payload.RootId].(*DomElementNode)
+	if !ok {
+		return nil, nil, fmt.Errorf("root node %s is missing or not an element", *payload.RootId)
+	}
+	selectorMap := make(SelectorMap)
+	const (
+		linking = 1 // on the path from the root
+		linked  = 2
+	)
+	states := make(map[string]int)
+	var linkFn func(id string, node *DomElementNode) error
+	linkFn = func(id string, node *DomElementNode) error {
+		states[id] = linking
+		if node.HighlightIndex != nil {
+			if selectorMap[*node.HighlightIndex] != nil {
+				return fmt.Errorf("highlight index %d is used twice", *node.HighlightIndex)
 			}
-			for _, childId := range elementNode.ChildrenIDs {
-				if nodeMap[childId] == nil {
-					continue
+			selectorMap[*node.HighlightIndex] = node
+		}
+		for _, childId := range node.ChildrenIDs {
+			switch states[childId] {
+			case linking:
+				return fmt.Errorf("cycle: node %s is a child of its descendant %s", childId, id)
+			case linked:
+				return fmt.Errorf("node %s is a child of several nodes", childId)
+			}
+			child, ok := nodeMap[childId]
+			if !ok {
+				return fmt.Errorf("child %s of node %s is missing", childId, id)
+			}
+			child.SetParent(node)
+			node.Childrens = append(node.Childrens, child)
+			if eChild, ok := child.(*DomElementNode); ok {
+				if err := linkFn(childId, eChild); err != nil {
+					return err
 				}
-				childNode := nodeMap[childId]
-				childNode.SetParent(elementNode)
-				elementNode.Childrens = append(elementNode.Childrens, childNode)
+			} else {
+				states[childId] = linked
 			}
-		} else {
-			panic("not supposed to be here")
 		}
+		states[id] = linked
+		return nil
 	}
-	var rootNode *DomElementNode
-	rootId, ok := mp["rootId"].(string)
-	if ok {
-		n, ok := nodeMap[rootId].(*DomElementNode)
-		if ok {
-			rootNode = n
-		}
+	if err := linkFn(*payload.RootId, rootNode); err != nil {
+		return nil, nil, err
 	}
-	for i, node := range nodeMap {
-		if tNode, ok := node.(*DomTextNode); ok {
-			fmt.Println(i, tNode.IsVisvable, tNode.Text)
-		} else if eNode, ok := node.(*DomElementNode); ok {
-			fmt.Println(i, *eNode)
-		}
-	}
-	return rootNode, selectorMap
+	return rootNode, selectorMap, nil
 }
 
+//go:embed buildDomTree.js
 var domJs string
+
 var removeHighlightJs = `try {
                     // Remove the highlight container and all its contents
                     const container = document.getElementById('playwright-highlight-container');
@@ -301,11 +509,3 @@ var removeHighlightJs = `try {
                 } catch (e) {
                     console.error('Failed to remove highlights:', e);
                 }`
-
-func init() {
-	jsScript, err := os.ReadFile("./browser/buildDomTree.js")
-	if err != nil {
-		panic(err)
-	}
-	domJs = string(jsScript)
-}
@@ -0,0 +1,243 @@
+package browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/chromedp"
+)
+
+var (
+	update  = flag.Bool("update", false, "rewrite the golden files of testdata/dom")
+	capture = flag.Bool("capture", false, "capture the payloads of testdata/dom from the pages of testdata/pages with chrome")
+)
+
+// the payloads of testdata/dom are the output of buildDomTree.js on the pages of testdata/pages.
+// run with -capture after changing the script or a page, then with -update for the golden files
+func TestCaptureDomPayloads(t *testing.T) {
+	if !*capture {
+		t.Skip("run with -capture to capture the payloads")
+	}
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	pages, err := filepath.Glob(filepath.Join("testdata", "pages", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("testdata", "pages"))))
+	defer server.Close()
+	b := NewBrowser()
+	defer b.Close()
+	// the coordinates and the viewport flags depend on the window
+	if err := b.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chromedp.Run(b.current, chromedp.EmulateViewport(1280, 800)); err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".html")
+		if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL + "/" + name + ".html"}); err != nil {
+			t.Fatal(err)
+		}
+		frames, err := b.getFrames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _, err := b.DomService.buildDomTree(frames[0], 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload bytes.Buffer
+		if err := json.Indent(&payload, out, "", "  "); err != nil {
+			t.Fatal(err)
+		}
+		payload.WriteString("\n")
+		if err := os.WriteFile(filepath.Join("testdata", "dom", name+".json"), payload.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// every payload of testdata/dom is built and serialized in each format, the outputs are compared
+// with the golden files next to it. run with -update after an intended change of the output
+func TestConstructDomTreeGolden(t *testing.T) {
+	payloads, err := filepath.Glob(filepath.Join("testdata", "dom", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) == 0 {
+		t.Fatal("no payloads in testdata/dom")
+	}
+	options := DefaultSerializeOptions()
+	options.CollapseWhitespace = true
+	serializers := map[string]DomSerializer{
+		DomFormatCompact: &CompactSerializer{DefaultSerializeOptions()},
+		DomFormatJson:    &JsonSerializer{options},
+		DomFormatHtml:    &HtmlSerializer{options},
+	}
+	for _, payload := range payloads {
+		name := strings.TrimSuffix(filepath.Base(payload), ".json")
+		data, err := os.ReadFile(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for format, serializer := range serializers {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				root, _, err := ConstructDomTree(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := mustSerialize(t, serializer, root) + "\n"
+				golden := filepath.Join("testdata", "dom", name+"."+format+".golden")
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != string(want) {
+					t.Errorf("output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+				}
+			})
+		}
+	}
+}
+
+// the map is unordered in go, building the same payload again must give the same tree
+func TestConstructDomTreeDeterministic(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "dom", "login.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, selectorMap, err := ConstructDomTree(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := root.GetCliableElementsString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		root, sMap, err := ConstructDomTree(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := root.GetCliableElementsString(); got != want {
+			t.Fatalf("run %d gave\n%s\nwant\n%s", i, got, want)
+		}
+		if len(sMap) != len(selectorMap) {
+			t.Fatalf("run %d found %d elements, want %d", i, len(sMap), len(selectorMap))
+		}
+	}
+	if len(selectorMap) != 5 {
+		t.Errorf("found %d interactive elements, want 5", len(selectorMap))
+	}
+	if selectorMap[2].Parent == nil || selectorMap[2].Parent.TagName != "label" {
+		t.Errorf("checkbox is not linked below its label")
+	}
+}
+
+func TestConstructDomTreeInvalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+		err     string
+	}{
+		{
+			name:    "missing child",
+			payload: `{"rootId": "0", "map": {"0": {"tagName": "body", "children": ["1"]}}}`,
+			err:     "child 1 of node 0 is missing",
+		},
+		{
+			name: "cycle",
+			payload: `{"rootId": "0", "map": {
+				"0": {"tagName": "body", "children": ["1"]},
+				"1": {"tagName": "div", "children": ["2"]},
+				"2": {"tagName": "div", "children": ["1"]}}}`,
+			err: "cycle: node 1 is a child of its descendant 2",
+		},
+		{
+			name: "several parents",
+			payload: `{"rootId": "0", "map": {
+				"0": {"tagName": "body", "children": ["1", "2"]},
+				"1": {"tagName": "div", "children": ["3"]},
+				"2": {"tagName": "div", "children": ["3"]},
+				"3": {"type": "TEXT_NODE", "text": "shared"}}}`,
+			err: "node 3 is a child of several nodes",
+		},
+		{
+			name:    "unknown type",
+			payload: `{"rootId": "0", "map": {"0": {"tagName": "body", "children": ["1"]}, "1": {"type": "COMMENT_NODE"}}}`,
+			err:     `invalid node 1: unknown node type "COMMENT_NODE"`,
+		},
+		{
+			name:    "no tag name",
+			payload: `{"rootId": "0", "map": {"0": {"tagName": "body", "children": ["1"]}, "1": {"children": []}}}`,
+			err:     "invalid node 1: node has neither a type nor a tag name",
+		},
+		{
+			name:    "missing root",
+			payload: `{"rootId": "5", "map": {"0": {"tagName": "body"}}}`,
+			err:     "root node 5 is missing or not an element",
+		},
+		{
+			name: "duplicate index",
+			payload: `{"rootId": "0", "map": {
+				"0": {"tagName": "body", "children": ["1", "2"]},
+				"1": {"tagName": "a", "highlightIndex": 3},
+				"2": {"tagName": "a", "highlightIndex": 3}}}`,
+			err: "highlight index 3 is used twice",
+		},
+		{
+			name:    "not json",
+			payload: `{"rootId": `,
+			err:     "invalid dom tree payload",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := ConstructDomTree([]byte(c.payload))
+			if err == nil {
+				t.Fatalf("no error, want %q", c.err)
+			}
+			if !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("error %q, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestConstructDomTreeRejectedBody(t *testing.T) {
+	root, selectorMap, err := ConstructDomTree([]byte(`{"rootId": null, "map": {}}`))
+	if err != nil || root != nil || len(selectorMap) != 0 {
+		t.Fatalf("got %v %v %v, want an empty tree", root, selectorMap, err)
+	}
+}
+
+// extraction errors are returned, the cached state stays as it was
+func TestUpdateStateWithoutChrome(t *testing.T) {
+	withoutChrome(t)
+	b := NewBrowser()
+	if err := b.UpdateState(); err == nil {
+		t.Fatal("state read without chrome")
+	}
+	if b.CachedState != nil {
+		t.Errorf("cached state %+v", b.CachedState)
+	}
+	if _, err := b.DomService.GetClickableElements(); err == nil {
+		t.Error("elements extracted without chrome")
+	}
+}
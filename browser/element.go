@@ -0,0 +1,360 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// frame of the document the node belongs to, the main document if unknown
+func (b *Browser) getNodeFrame(node *DomElementNode) (*frameContext, error) {
+	if frame := b.DomService.getFrame(node.FrameId); frame != nil {
+		return frame, nil
+	}
+	if len(b.DomService.frames) > 0 {
+		return b.DomService.frames[0], nil
+	}
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return nil, err
+	}
+	return &frameContext{ctx: tab}, nil
+}
+
+// locate the node at action time, by backend node id first, then by xpath and css selector
+func (b *Browser) locateElement(node *DomElementNode) (*frameContext, cdp.BackendNodeID, error) {
+	frame, err := b.getNodeFrame(node)
+	if err != nil {
+		return nil, 0, err
+	}
+	var backendNodeId cdp.BackendNodeID
+	err = chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		if node.BackendNodeId != 0 {
+			id := cdp.BackendNodeID(node.BackendNodeId)
+			if isConnected(ctx, id) {
+				backendNodeId = id
+				return nil
+			}
+		}
+		// the node was replaced, fall back to the selectors
+		expressions := []string{xpathExpression(node.XPath)}
+		if css := cssExpression(node); css != "" {
+			expressions = append(expressions, css)
+		}
+		for _, expression := range expressions {
+			id, err := frame.queryElement(ctx, expression)
+			if err != nil {
+				continue
+			}
+			backendNodeId = id
+			return nil
+		}
+		return fmt.Errorf("element [%s] %s not found", node.TagName, node.XPath)
+	}))
+	return frame, backendNodeId, err
+}
+
+// whether the backend node is still attached to the document
+func isConnected(ctx context.Context, backendNodeId cdp.BackendNodeID) bool {
+	obj, err := dom.ResolveNode().WithBackendNodeID(backendNodeId).Do(ctx)
+	if err != nil {
+		return false
+	}
+	defer runtime.ReleaseObject(obj.ObjectID).Do(ctx)
+	var connected bool
+	err = chromedp.CallFunctionOn(`function() { return this.isConnected; }`, &connected, func(p *runtime.CallFunctionOnParams) *runtime.CallFunctionOnParams {
+		return p.WithObjectID(obj.ObjectID)
+	}).Do(ctx)
+	return err == nil && connected
+}
+
+func xpathExpression(xpath string) string {
+	return fmt.Sprintf(`document.evaluate(%s, document, null, XPathResult.FIRST_ORDERED_NODE_TYPE, null).singleNodeValue`, JsString(xpath))
+}
+
+// css selector from the identifying attributes, empty when the node has none
+func cssExpression(node *DomElementNode) string {
+	if id := node.Attributes["id"]; id != "" {
+		return fmt.Sprintf(`document.querySelector(%s + "#" + CSS.escape(%s))`, JsString(node.TagName), JsString(id))
+	}
+	if name := node.Attributes["name"]; name != "" {
+		return fmt.Sprintf(`document.querySelector(%s + "[name=\"" + CSS.escape(%s) + "\"]")`, JsString(node.TagName), JsString(name))
+	}
+	return ""
+}
+
+// scroll the element into view and return the center of its content box in viewport coordinates
+func (b *Browser) getElementCenter(frame *frameContext, backendNodeId cdp.BackendNodeID) (float64, float64, error) {
+	var x, y float64
+	err := chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := dom.ScrollIntoViewIfNeeded().WithBackendNodeID(backendNodeId).Do(ctx); err != nil {
+			return err
+		}
+		model, err := dom.GetBoxModel().WithBackendNodeID(backendNodeId).Do(ctx)
+		if err != nil {
+			return err
+		}
+		x, y = quadCenter(model.Content)
+		return nil
+	}))
+	if err != nil {
+		return 0, 0, err
+	}
+	offsetX, offsetY, err := b.getFrameOffset(frame)
+	if err != nil {
+		return 0, 0, err
+	}
+	return x + offsetX, y + offsetY, nil
+}
+
+// scroll the element into view and return its border box in viewport coordinates
+func (b *Browser) getElementBox(frame *frameContext, backendNodeId cdp.BackendNodeID) (x, y, width, height float64, err error) {
+	err = chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := dom.ScrollIntoViewIfNeeded().WithBackendNodeID(backendNodeId).Do(ctx); err != nil {
+			return err
+		}
+		model, err := dom.GetBoxModel().WithBackendNodeID(backendNodeId).Do(ctx)
+		if err != nil {
+			return err
+		}
+		x, y = model.Border[0], model.Border[1]
+		width, height = float64(model.Width), float64(model.Height)
+		return nil
+	}))
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	offsetX, offsetY, err := b.getFrameOffset(frame)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return x + offsetX, y + offsetY, width, height, nil
+}
+
+// out of process iframes report coordinates relative to their own viewport,
+// add the position of every such owner iframe up to the main frame
+func (b *Browser) getFrameOffset(frame *frameContext) (float64, float64, error) {
+	var offsetX, offsetY float64
+	for f := frame; f != nil && !f.isMainFrame(); {
+		parent := b.DomService.getFrame(f.ParentId)
+		if parent == nil {
+			break
+		}
+		if f.IsOOPIF {
+			err := chromedp.Run(parent.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+				owner, _, err := dom.GetFrameOwner(cdp.FrameID(f.FrameId)).Do(ctx)
+				if err != nil {
+					return err
+				}
+				model, err := dom.GetBoxModel().WithBackendNodeID(owner).Do(ctx)
+				if err != nil {
+					return err
+				}
+				offsetX += model.Content[0]
+				offsetY += model.Content[1]
+				return nil
+			}))
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		f = parent
+	}
+	return offsetX, offsetY, nil
+}
+
+func quadCenter(quad dom.Quad) (float64, float64) {
+	var x, y float64
+	points := len(quad) / 2
+	for i := 0; i < points; i++ {
+		x += quad[2*i]
+		y += quad[2*i+1]
+	}
+	return x / float64(points), y / float64(points)
+}
+
+// click the node with real mouse events dispatched on the tab
+func (b *Browser) clickNode(node *DomElementNode) error {
+	frame, backendNodeId, err := b.locateElement(node)
+	if err != nil {
+		return err
+	}
+	return b.clickBackendNode(frame, backendNodeId)
+}
+
+func (b *Browser) clickBackendNode(frame *frameContext, backendNodeId cdp.BackendNodeID) error {
+	x, y, err := b.getElementCenter(frame, backendNodeId)
+	if err != nil {
+		return err
+	}
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(tab, chromedp.MouseClickXY(x, y))
+}
+
+// focus the node and type the text, key events are routed to the focused frame
+func (b *Browser) inputNode(node *DomElementNode, text string) error {
+	frame, backendNodeId, err := b.locateElement(node)
+	if err != nil {
+		return err
+	}
+	return b.inputBackendNode(frame, backendNodeId, text)
+}
+
+func (b *Browser) inputBackendNode(frame *frameContext, backendNodeId cdp.BackendNodeID, text string) error {
+	err := chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := dom.ScrollIntoViewIfNeeded().WithBackendNodeID(backendNodeId).Do(ctx); err != nil {
+			return err
+		}
+		return dom.Focus().WithBackendNodeID(backendNodeId).Do(ctx)
+	}))
+	if err != nil {
+		return err
+	}
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(tab, chromedp.KeyEvent(text))
+}
+
+// the first element of the current tab's document matching the css selector
+func (b *Browser) locateSelector(selector string) (*frameContext, cdp.BackendNodeID, error) {
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return nil, 0, err
+	}
+	frame := &frameContext{ctx: tab}
+	var backendNodeId cdp.BackendNodeID
+	err = chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		id, err := frame.queryElement(ctx, fmt.Sprintf("document.querySelector(%s)", JsString(selector)))
+		if err != nil {
+			return fmt.Errorf("no element matches %q", selector)
+		}
+		backendNodeId = id
+		return nil
+	}))
+	return frame, backendNodeId, err
+}
+
+// the element with the index was replaced or is gone since the state the model has seen
+type StaleElementError struct {
+	Index   int
+	TagName string
+	Reason  string
+}
+
+func (e *StaleElementError) Error() string {
+	if e.TagName == "" {
+		return fmt.Sprintf("element with index %d is stale: %s", e.Index, e.Reason)
+	}
+	return fmt.Sprintf("element [%d]<%s> is stale: %s", e.Index, e.TagName, e.Reason)
+}
+
+// the element with the highlight index of the cached state. when its node is no longer in the page
+// or changed, the element is re-located by its identity hash in a fresh snapshot
+func (b *Browser) getIndexElement(index int) (*DomElementNode, error) {
+	smp := b.getSelectorMap()
+	if smp == nil || smp[index] == nil {
+		return nil, &StaleElementError{Index: index, Reason: "the index does not exist"}
+	}
+	node := smp[index]
+	if b.isLiveNode(node) {
+		return node, nil
+	}
+	identity := node.IdentityHash()
+	fresh, err := b.DomService.probe()
+	if err != nil {
+		return nil, err
+	}
+	if current := fresh.SelectorMap[index]; current != nil && current.IdentityHash() == identity {
+		return current, nil
+	}
+	var found *DomElementNode
+	for _, current := range fresh.SelectorMap {
+		if current.IdentityHash() != identity {
+			continue
+		}
+		if found != nil {
+			return nil, &StaleElementError{Index: index, TagName: node.TagName, Reason: "the page changed and several elements match it"}
+		}
+		found = current
+	}
+	if found == nil {
+		return nil, &StaleElementError{Index: index, TagName: node.TagName, Reason: "the page changed and it is gone"}
+	}
+	return found, nil
+}
+
+// read the tag and the key attributes of the element in the page
+var liveNodeJs = `function(names) {
+  const attributes = {};
+  for (const name of names) {
+    if (this.hasAttribute(name)) attributes[name] = this.getAttribute(name);
+  }
+  return { connected: this.isConnected, tagName: this.tagName.toLowerCase(), attributes };
+}`
+
+type liveNode struct {
+	Connected  bool              `json:"connected"`
+	TagName    string            `json:"tagName"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// the backend node of the element is still attached and has its tag and key attributes,
+// the check costs two calls instead of a snapshot of the page
+func (b *Browser) isLiveNode(node *DomElementNode) bool {
+	if node.BackendNodeId == 0 {
+		return false
+	}
+	frame, err := b.getNodeFrame(node)
+	if err != nil {
+		return false
+	}
+	var live liveNode
+	err = chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		obj, err := dom.ResolveNode().WithBackendNodeID(cdp.BackendNodeID(node.BackendNodeId)).Do(ctx)
+		if err != nil {
+			return err
+		}
+		defer runtime.ReleaseObject(obj.ObjectID).Do(ctx)
+		return chromedp.CallFunctionOn(liveNodeJs, &live, func(p *runtime.CallFunctionOnParams) *runtime.CallFunctionOnParams {
+			return p.WithObjectID(obj.ObjectID)
+		}, hashAttributes).Do(ctx)
+	}))
+	return err == nil && live.matches(node)
+}
+
+func (l *liveNode) matches(node *DomElementNode) bool {
+	if !l.Connected || !strings.EqualFold(l.TagName, node.TagName) {
+		return false
+	}
+	for _, key := range hashAttributes {
+		value, ok := node.Attributes[key]
+		liveValue, liveOk := l.Attributes[key]
+		if ok != liveOk || value != liveValue {
+			return false
+		}
+	}
+	return true
+}
+
+// center of the element with the highlight index, located at action time
+func (b *Browser) getIndexCenter(index int) (float64, float64, error) {
+	node, err := b.getIndexElement(index)
+	if err != nil {
+		return 0, 0, err
+	}
+	frame, backendNodeId, err := b.locateElement(node)
+	if err != nil {
+		return 0, 0, err
+	}
+	return b.getElementCenter(frame, backendNodeId)
+}
@@ -0,0 +1,374 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+	"github.com/go-json-experiment/json/jsontext"
+)
+
+// attribute stamped on iframe owner elements, so child frame trees can be linked to them
+const frameIdAttribute = "browser-use-frame-id"
+
+// object group of remote objects created while extracting the dom tree
+const objectGroup = "browser-use"
+
+// one document of the current tab, the main frame or an iframe
+type frameContext struct {
+	FrameId  string
+	ParentId string
+	IsOOPIF  bool                       // out of process iframe, lives in its own target
+	ctx      context.Context            // chromedp context of the target owning this frame
+	execCtx  runtime.ExecutionContextID // 0 means the default context of the target
+}
+
+func (f *frameContext) isMainFrame() bool {
+	return f.ParentId == ""
+}
+
+// evaluate expression in the frame and return the json value
+func (f *frameContext) evaluate(expression string) ([]byte, error) {
+	var out []byte
+	err := chromedp.Run(f.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		p := runtime.Evaluate(expression).WithReturnByValue(true).WithAwaitPromise(true)
+		if f.execCtx != 0 {
+			p = p.WithContextID(f.execCtx)
+		}
+		res, exp, err := p.Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exp != nil {
+			return exp
+		}
+		out = []byte(res.Value)
+		return nil
+	}))
+	return out, err
+}
+
+// evaluate the dom tree script, returning its json output and the backend node ids of the highlighted elements
+func (f *frameContext) evaluateDomTree(expression string) ([]byte, []cdp.BackendNodeID, error) {
+	var out []byte
+	var backendNodeIds []cdp.BackendNodeID
+	err := chromedp.Run(f.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		defer runtime.ReleaseObjectGroup(objectGroup).Do(ctx)
+		p := runtime.Evaluate(expression).WithObjectGroup(objectGroup)
+		if f.execCtx != 0 {
+			p = p.WithContextID(f.execCtx)
+		}
+		res, exp, err := p.Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exp != nil {
+			return exp
+		}
+		// elements can not be returned by value, serialize the tree in the page instead
+		tree, exp, err := runtime.CallFunctionOn(`function() { return JSON.stringify({rootId: this.rootId, map: this.map}); }`).
+			WithObjectID(res.ObjectID).
+			WithReturnByValue(true).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exp != nil {
+			return exp
+		}
+		var data string
+		if err := json.Unmarshal(tree.Value, &data); err != nil {
+			return err
+		}
+		out = []byte(data)
+		elements, exp, err := runtime.CallFunctionOn(`function() { return this.elements; }`).
+			WithObjectID(res.ObjectID).
+			WithObjectGroup(objectGroup).
+			Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exp != nil {
+			return exp
+		}
+		props, _, _, exp, err := runtime.GetProperties(elements.ObjectID).WithOwnProperties(true).Do(ctx)
+		if err != nil {
+			return err
+		}
+		if exp != nil {
+			return exp
+		}
+		backendNodeIds = make([]cdp.BackendNodeID, len(props))
+		count := 0
+		for _, prop := range props {
+			i, err := strconv.Atoi(prop.Name)
+			if err != nil || i >= len(backendNodeIds) || prop.Value == nil || prop.Value.ObjectID == "" {
+				// length and other non index properties
+				continue
+			}
+			node, err := dom.DescribeNode().WithObjectID(prop.Value.ObjectID).Do(ctx)
+			if err != nil {
+				return err
+			}
+			backendNodeIds[i] = node.BackendNodeID
+			count = max(count, i+1)
+		}
+		backendNodeIds = backendNodeIds[:count]
+		return nil
+	}))
+	return out, backendNodeIds, err
+}
+
+// evaluate an expression returning an element inside the frame document, the backend node of
+// the element is returned and its remote object released
+func (f *frameContext) queryElement(ctx context.Context, expression string) (cdp.BackendNodeID, error) {
+	p := runtime.Evaluate(expression)
+	if f.execCtx != 0 {
+		p = p.WithContextID(f.execCtx)
+	}
+	res, exp, err := p.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if exp != nil {
+		return 0, exp
+	}
+	if res.ObjectID == "" {
+		return 0, fmt.Errorf("%s not found in frame %s", expression, f.FrameId)
+	}
+	defer runtime.ReleaseObject(res.ObjectID).Do(ctx)
+	n, err := dom.DescribeNode().WithObjectID(res.ObjectID).Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return n.BackendNodeID, nil
+}
+
+func callFunctionOn(ctx context.Context, objectId runtime.RemoteObjectID, function string, args ...any) error {
+	callArgs := make([]*runtime.CallArgument, 0, len(args))
+	for _, arg := range args {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		callArgs = append(callArgs, &runtime.CallArgument{Value: jsontext.Value(data)})
+	}
+	_, exp, err := runtime.CallFunctionOn(function).
+		WithObjectID(objectId).
+		WithArguments(callArgs).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	if exp != nil {
+		return exp
+	}
+	return nil
+}
+
+// collect all frames of the current tab, main frame first
+func (b *Browser) getFrames() ([]*frameContext, error) {
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return nil, err
+	}
+	frames, err := b.collectTargetFrames(tab, false)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, f := range frames {
+		known[f.FrameId] = true
+	}
+	// out of process iframes are separate targets whose target id is the frame id
+	infos, err := chromedp.Targets(tab)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]*target.Info, 0)
+	live := make(map[string]bool)
+	for _, info := range infos {
+		if info.Type == "iframe" {
+			pending = append(pending, info)
+			live[string(info.TargetID)] = true
+		}
+	}
+	// targets of detached iframes are gone, stop listening to them
+	for targetId, t := range b.frameTargets {
+		if !live[targetId] {
+			t.cancel()
+			delete(b.frameTargets, targetId)
+			delete(b.worlds, t.ctx)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		rest := pending[:0]
+		for _, info := range pending {
+			ctx := b.getFrameTarget(string(info.TargetID))
+			oopifFrames, err := b.collectTargetFrames(ctx, true)
+			if err != nil || len(oopifFrames) == 0 {
+				rest = append(rest, info)
+				continue
+			}
+			root := oopifFrames[0]
+			if root.ParentId == "" || !known[root.ParentId] {
+				// parent id is not always reported, ask the targets we know who owns the frame
+				root.ParentId = findFrameOwner(frames, root.FrameId)
+			}
+			if root.ParentId == "" {
+				// not belonging to this tab, or parent not discovered yet
+				rest = append(rest, info)
+				continue
+			}
+			for _, f := range oopifFrames {
+				if known[f.FrameId] {
+					continue
+				}
+				known[f.FrameId] = true
+				frames = append(frames, f)
+			}
+			changed = true
+		}
+		pending = rest
+	}
+	return frames, nil
+}
+
+// an attached iframe target, cancelled when the iframe is detached
+type frameTarget struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// chromedp context attached to an iframe target, cached by target id
+func (b *Browser) getFrameTarget(targetId string) context.Context {
+	if b.frameTargets == nil {
+		b.frameTargets = make(map[string]*frameTarget)
+	}
+	if t, ok := b.frameTargets[targetId]; ok {
+		return t.ctx
+	}
+	ctx, cancel := chromedp.NewContext(b.ctx, chromedp.WithTargetID(target.ID(targetId)))
+	b.frameTargets[targetId] = &frameTarget{ctx: ctx, cancel: cancel}
+	return ctx
+}
+
+// an isolated world of a frame document, it lives as long as the document
+type isolatedWorld struct {
+	loaderId cdp.LoaderID
+	execCtx  runtime.ExecutionContextID
+}
+
+func newIsolatedWorld(ctx context.Context, frame *cdp.Frame) (*isolatedWorld, error) {
+	var execCtx runtime.ExecutionContextID
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		execCtx, err = page.CreateIsolatedWorld(frame.ID).WithWorldName("browser-use").Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return &isolatedWorld{loaderId: frame.LoaderID, execCtx: execCtx}, nil
+}
+
+// walk the frame tree of one target, frames living in other targets are skipped. every
+// Page.createIsolatedWorld makes a new world, so the world of a frame document is kept
+// until the frame loads another document or is detached
+func (b *Browser) collectTargetFrames(ctx context.Context, oopif bool) ([]*frameContext, error) {
+	var tree *page.FrameTree
+	if err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		tree, err = page.GetFrameTree().Do(ctx)
+		return err
+	})); err != nil {
+		return nil, err
+	}
+	frames := make([]*frameContext, 0)
+	previous := b.worlds[ctx]
+	worlds := make(map[string]*isolatedWorld)
+	var walkFn func(tree *page.FrameTree, isRoot bool)
+	walkFn = func(tree *page.FrameTree, isRoot bool) {
+		f := &frameContext{
+			FrameId:  string(tree.Frame.ID),
+			ParentId: string(tree.Frame.ParentID),
+			IsOOPIF:  oopif && isRoot,
+			ctx:      ctx,
+		}
+		if f.ParentId != "" {
+			w := previous[f.FrameId]
+			if w == nil || w.loaderId != tree.Frame.LoaderID {
+				var err error
+				if w, err = newIsolatedWorld(ctx, tree.Frame); err != nil {
+					// frame is rendered by another process
+					return
+				}
+			}
+			worlds[f.FrameId] = w
+			f.execCtx = w.execCtx
+		}
+		frames = append(frames, f)
+		for _, child := range tree.ChildFrames {
+			walkFn(child, false)
+		}
+	}
+	walkFn(tree, true)
+	if b.worlds == nil {
+		b.worlds = make(map[context.Context]map[string]*isolatedWorld)
+	}
+	b.worlds[ctx] = worlds
+	return frames, nil
+}
+
+// return the id of a frame whose target contains the owner element of frameId
+func findFrameOwner(frames []*frameContext, frameId string) string {
+	for _, f := range frames {
+		err := chromedp.Run(f.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+			_, _, err := dom.GetFrameOwner(cdp.FrameID(frameId)).Do(ctx)
+			return err
+		}))
+		if err == nil {
+			return f.FrameId
+		}
+	}
+	return ""
+}
+
+// JsString quotes s as a javascript string literal. go's %q escapes are not all valid javascript, like \a, \x or \U
+func JsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// mark the iframe element owning the frame, the owner lives in the parent frame's target
+func stampFrameOwner(parent *frameContext, frameId string) error {
+	return callOnFrameOwner(parent, frameId, fmt.Sprintf(`function(id) { this.setAttribute(%s, id); }`, JsString(frameIdAttribute)), frameId)
+}
+
+// remove the mark of stampFrameOwner
+func unstampFrameOwner(parent *frameContext, frameId string) error {
+	return callOnFrameOwner(parent, frameId, fmt.Sprintf(`function() { this.removeAttribute(%s); }`, JsString(frameIdAttribute)))
+}
+
+func callOnFrameOwner(parent *frameContext, frameId string, function string, args ...any) error {
+	return chromedp.Run(parent.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		backendNodeId, _, err := dom.GetFrameOwner(cdp.FrameID(frameId)).Do(ctx)
+		if err != nil {
+			return err
+		}
+		obj, err := dom.ResolveNode().WithBackendNodeID(backendNodeId).Do(ctx)
+		if err != nil {
+			return err
+		}
+		defer runtime.ReleaseObject(obj.ObjectID).Do(ctx)
+		return callFunctionOn(ctx, obj.ObjectID, function, args...)
+	}))
+}
@@ -0,0 +1,115 @@
+package browser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+)
+
+// strings go's %q quotes into invalid or different javascript
+var jsStrings = []string{
+	`plain`,
+	`"double" and 'single' quotes`,
+	`back\slash`,
+	"bell \a and escape \x1b",
+	"invalid utf-8 \xff",
+	"astral \U0001F600",
+	"line separator \u2028",
+	`</script>`,
+}
+
+func TestJsString(t *testing.T) {
+	for _, s := range jsStrings {
+		var back string
+		if err := json.Unmarshal([]byte(JsString(s)), &back); err != nil {
+			t.Errorf("JsString(%q) = %s: %v", s, JsString(s), err)
+		}
+	}
+	if got := JsString("bell \a"); got != `"bell \u0007"` {
+		t.Errorf("JsString = %s", got)
+	}
+}
+
+func TestJsStringInChrome(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	b := NewBrowser()
+	defer b.Close()
+	for _, s := range jsStrings {
+		out, err := b.ExecJavascript(&ExecJavascriptParam{Content: JsString(s)})
+		if err != nil {
+			t.Errorf("JsString(%q) = %s: %v", s, JsString(s), err)
+			continue
+		}
+		var got string
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatal(err)
+		}
+		// invalid utf-8 is replaced by json
+		want, _ := json.Marshal(s)
+		var wantString string
+		_ = json.Unmarshal(want, &wantString)
+		if got != wantString {
+			t.Errorf("javascript evaluated JsString(%q) to %q", s, got)
+		}
+	}
+}
+
+func TestFrameWorldsAndTargets(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<iframe id="same" srcdoc="<button>same</button>"></iframe>`))
+	}))
+	defer server.Close()
+	b := NewBrowser()
+	defer b.Close()
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	// the world of the in process iframe
+	world := func() runtime.ExecutionContextID {
+		t.Helper()
+		frames, err := b.getFrames()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range frames {
+			if !f.isMainFrame() && !f.IsOOPIF && f.ctx == b.current {
+				return f.execCtx
+			}
+		}
+		t.Fatal("the in process iframe is not found")
+		return 0
+	}
+	first := world()
+	if first == 0 || world() != first {
+		t.Errorf("a new world for the same document")
+	}
+	if _, err := b.ExecJavascript(&ExecJavascriptParam{Content: `document.getElementById("same").srcdoc = "<button>again</button>"`}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); world() == first; {
+		if time.Now().After(deadline) {
+			t.Fatal("the world of the replaced document is kept")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// chromedp turns site isolation off by default, a target of an iframe detached meanwhile stands in
+	gone, cancel := context.WithCancel(context.Background())
+	b.frameTargets = map[string]*frameTarget{"detached": {ctx: gone, cancel: cancel}}
+	b.worlds[gone] = map[string]*isolatedWorld{"frame": {execCtx: 1}}
+	world()
+	if len(b.frameTargets) != 0 || gone.Err() == nil || b.worlds[gone] != nil {
+		t.Error("the target of the detached iframe is kept")
+	}
+}
@@ -0,0 +1,453 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// HAR 1.2, see http://www.softwareishard.com/blog/har-12-spec/
+type Har struct {
+	Log *HarLog `json:"log"`
+}
+
+type HarLog struct {
+	Version string      `json:"version"`
+	Creator *HarCreator `json:"creator"`
+	Pages   []*HarPage  `json:"pages"`
+	Entries []*HarEntry `json:"entries"`
+}
+
+type HarCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HarPage struct {
+	StartedDateTime string          `json:"startedDateTime"`
+	Id              string          `json:"id"`
+	Title           string          `json:"title"`
+	PageTimings     *HarPageTimings `json:"pageTimings"`
+}
+
+type HarPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type HarEntry struct {
+	Pageref         string       `json:"pageref,omitempty"`
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HarRequest  `json:"request"`
+	Response        *HarResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HarTimings  `json:"timings"`
+	ServerIPAddress string       `json:"serverIPAddress,omitempty"`
+	ResourceType    string       `json:"_resourceType,omitempty"`
+	Error           string       `json:"_error,omitempty"`
+	wallTime        time.Time
+}
+
+type HarRequest struct {
+	Method      string          `json:"method"`
+	Url         string          `json:"url"`
+	HttpVersion string          `json:"httpVersion"`
+	Cookies     []*HarCookie    `json:"cookies"`
+	Headers     []*HarNameValue `json:"headers"`
+	QueryString []*HarNameValue `json:"queryString"`
+	PostData    *HarPostData    `json:"postData,omitempty"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HarResponse struct {
+	Status      int64           `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HttpVersion string          `json:"httpVersion"`
+	Cookies     []*HarCookie    `json:"cookies"`
+	Headers     []*HarNameValue `json:"headers"`
+	Content     *HarContent     `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int             `json:"headersSize"`
+	BodySize    int             `json:"bodySize"`
+}
+
+type HarCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HarPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type HarContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// durations in milliseconds, -1 when not applicable
+type HarTimings struct {
+	Blocked float64 `json:"blocked"`
+	Dns     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	Ssl     float64 `json:"ssl"`
+}
+
+// request in flight
+type harRequest struct {
+	entry   *HarEntry
+	started time.Time // monotonic timestamp of the request
+	timing  *network.ResourceTiming
+}
+
+// records network events of every tab
+type harRecorder struct {
+	mu          sync.Mutex
+	content     bool // record response bodies
+	maxBodySize int
+	pages       []*HarPage
+	entries     []*HarEntry
+	inFlight    map[network.RequestID]*harRequest
+	pendingBody sync.WaitGroup
+}
+
+func newHarRecorder(content bool, maxBodySize int) *harRecorder {
+	return &harRecorder{
+		content:     content,
+		maxBodySize: maxBodySize,
+		pages:       make([]*HarPage, 0),
+		entries:     make([]*HarEntry, 0),
+		inFlight:    make(map[network.RequestID]*harRequest),
+	}
+}
+
+// start recording the network of every tab, including the ones opened later
+func (b *Browser) StartHarRecording(content bool, maxBodySize int) {
+	b.har = newHarRecorder(content, maxBodySize)
+	for _, tab := range b.tabs {
+		b.listenHar(tab)
+	}
+}
+
+// write all requests recorded so far as a HAR file
+func (b *Browser) SaveHar(path string) error {
+	if b.har == nil {
+		return fmt.Errorf("har recording is not started")
+	}
+	data, err := json.MarshalIndent(b.har.build(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (b *Browser) listenHar(tab context.Context) {
+	recorder := b.har
+	if recorder == nil {
+		return
+	}
+	// one page per tab, titled by the first document loaded in it
+	page := recorder.addPage()
+	pageId := page.Id
+	chromedp.ListenTarget(tab, func(ev any) {
+		switch ev := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			recorder.onRequest(pageId, ev)
+		case *network.EventResponseReceived:
+			recorder.onResponse(ev.RequestID, ev.Response)
+		case *network.EventLoadingFinished:
+			req := recorder.finish(ev.RequestID, ev.Timestamp, "")
+			if req != nil && recorder.content {
+				recorder.pendingBody.Add(1)
+				// fetching the body from the listener goroutine would dead lock
+				go func() {
+					defer recorder.pendingBody.Done()
+					c := chromedp.FromContext(tab)
+					body, err := network.GetResponseBody(ev.RequestID).Do(cdp.WithExecutor(tab, c.Target))
+					recorder.setBody(req.entry, body, err)
+				}()
+			}
+		case *network.EventLoadingFailed:
+			recorder.finish(ev.RequestID, ev.Timestamp, ev.ErrorText)
+		}
+	})
+}
+
+func (r *harRecorder) addPage() *HarPage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	page := &HarPage{
+		StartedDateTime: time.Now().Format(time.RFC3339Nano),
+		Id:              fmt.Sprintf("page_%d", len(r.pages)+1),
+		PageTimings:     &HarPageTimings{OnContentLoad: -1, OnLoad: -1},
+	}
+	r.pages = append(r.pages, page)
+	return page
+}
+
+func (r *harRecorder) getPage(pageId string) *HarPage {
+	for _, page := range r.pages {
+		if page.Id == pageId {
+			return page
+		}
+	}
+	return nil
+}
+
+func (r *harRecorder) onRequest(pageId string, ev *network.EventRequestWillBeSent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prev := r.inFlight[ev.RequestID]; prev != nil && ev.RedirectResponse != nil {
+		// redirects reuse the request id, the redirect response completes the previous entry
+		r.setResponse(prev, ev.RedirectResponse)
+		r.complete(ev.RequestID, prev, ev.Timestamp.Time())
+	}
+	if page := r.getPage(pageId); page != nil && page.Title == "" && ev.Type == network.ResourceTypeDocument {
+		page.Title = ev.Request.URL
+	}
+	request := &HarRequest{
+		Method:      ev.Request.Method,
+		Url:         ev.Request.URL + ev.Request.URLFragment,
+		HttpVersion: "HTTP/1.1",
+		Cookies:     make([]*HarCookie, 0),
+		Headers:     harHeaders(ev.Request.Headers),
+		QueryString: harQueryString(ev.Request.URL),
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if ev.Request.HasPostData {
+		postData := harPostData(ev.Request)
+		request.PostData = &HarPostData{
+			MimeType: harHeaderValue(ev.Request.Headers, "Content-Type"),
+			Text:     postData,
+		}
+		request.BodySize = len(postData)
+	}
+	r.inFlight[ev.RequestID] = &harRequest{
+		entry: &HarEntry{
+			Pageref:         pageId,
+			StartedDateTime: ev.WallTime.Time().Format(time.RFC3339Nano),
+			wallTime:        ev.WallTime.Time(),
+			Request:         request,
+			Response: &HarResponse{
+				Cookies: make([]*HarCookie, 0),
+				Headers: make([]*HarNameValue, 0),
+				Content: &HarContent{MimeType: "x-unknown"},
+			},
+			Timings:      &HarTimings{Blocked: -1, Dns: -1, Connect: -1, Ssl: -1},
+			ResourceType: string(ev.Type),
+		},
+		started: ev.Timestamp.Time(),
+	}
+}
+
+func (r *harRecorder) onResponse(requestId network.RequestID, response *network.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req := r.inFlight[requestId]; req != nil {
+		r.setResponse(req, response)
+	}
+}
+
+func (r *harRecorder) setResponse(req *harRequest, response *network.Response) {
+	req.timing = response.Timing
+	httpVersion := harHttpVersion(response.Protocol)
+	req.entry.Request.HttpVersion = httpVersion
+	if len(response.RequestHeaders) > 0 {
+		// the headers actually sent, including cookies
+		req.entry.Request.Headers = harHeaders(response.RequestHeaders)
+	}
+	req.entry.Response.Status = response.Status
+	req.entry.Response.StatusText = response.StatusText
+	req.entry.Response.HttpVersion = httpVersion
+	req.entry.Response.Headers = harHeaders(response.Headers)
+	req.entry.Response.RedirectURL = harHeaderValue(response.Headers, "Location")
+	req.entry.Response.HeadersSize = -1
+	req.entry.Response.BodySize = int(response.EncodedDataLength)
+	req.entry.Response.Content.MimeType = response.MimeType
+	req.entry.ServerIPAddress = strings.Trim(response.RemoteIPAddress, "[]")
+}
+
+// finish a request, the entry is returned for loading its body
+func (r *harRecorder) finish(requestId network.RequestID, timestamp *cdp.MonotonicTime, errorText string) *harRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	req := r.inFlight[requestId]
+	if req == nil {
+		return nil
+	}
+	req.entry.Error = errorText
+	r.complete(requestId, req, timestamp.Time())
+	return req
+}
+
+func (r *harRecorder) complete(requestId network.RequestID, req *harRequest, finished time.Time) {
+	delete(r.inFlight, requestId)
+	timings := req.entry.Timings
+	total := float64(finished.Sub(req.started)) / float64(time.Millisecond)
+	if t := req.timing; t != nil {
+		// chrome timings are offsets in milliseconds from the request time
+		blockedEnd := t.SendStart
+		for _, start := range []float64{t.ConnectStart, t.DNSStart} {
+			if start >= 0 {
+				blockedEnd = start
+			}
+		}
+		timings.Blocked = max(blockedEnd, 0)
+		if t.DNSStart >= 0 {
+			timings.Dns = t.DNSEnd - t.DNSStart
+		}
+		if t.ConnectStart >= 0 {
+			timings.Connect = t.ConnectEnd - t.ConnectStart
+		}
+		if t.SslStart >= 0 {
+			timings.Ssl = t.SslEnd - t.SslStart
+		}
+		timings.Send = max(t.SendEnd-t.SendStart, 0)
+		timings.Wait = max(t.ReceiveHeadersEnd-t.SendEnd, 0)
+		requestStart := float64(req.started.Sub(*cdp.MonotonicTimeEpoch)) / float64(time.Millisecond)
+		timingStart := t.RequestTime * 1000
+		headersEnd := timingStart + t.ReceiveHeadersEnd - requestStart
+		timings.Receive = max(total-headersEnd, 0)
+		total = max(total, headersEnd)
+	} else {
+		timings.Send = 0
+		timings.Wait = 0
+		timings.Receive = max(total, 0)
+	}
+	req.entry.Time = max(timings.Blocked, 0) + max(timings.Dns, 0) + max(timings.Connect, 0) +
+		timings.Send + timings.Wait + timings.Receive
+	r.entries = append(r.entries, req.entry)
+}
+
+func (r *harRecorder) setBody(entry *HarEntry, body []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	content := entry.Response.Content
+	content.Size = len(body)
+	if err != nil {
+		content.Comment = fmt.Sprintf("body not available: %v", err)
+		return
+	}
+	if r.maxBodySize > 0 && len(body) > r.maxBodySize {
+		content.Comment = fmt.Sprintf("body of %d bytes exceeds the %d bytes cap", len(body), r.maxBodySize)
+		return
+	}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+}
+
+// snapshot of everything recorded, requests still in flight are left out
+func (r *harRecorder) build() *Har {
+	r.pendingBody.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := append([]*HarEntry(nil), r.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].wallTime.Before(entries[j].wallTime)
+	})
+	return &Har{
+		Log: &HarLog{
+			Version: "1.2",
+			Creator: &HarCreator{Name: "browser-use", Version: "0.1"},
+			Pages:   append([]*HarPage(nil), r.pages...),
+			Entries: entries,
+		},
+	}
+}
+
+func harHeaders(headers network.Headers) []*HarNameValue {
+	ret := make([]*HarNameValue, 0, len(headers))
+	for name, value := range headers {
+		// repeated headers are joined by new lines
+		for _, v := range strings.Split(fmt.Sprint(value), "\n") {
+			ret = append(ret, &HarNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func harHeaderValue(headers network.Headers, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+func harQueryString(rawUrl string) []*HarNameValue {
+	ret := make([]*HarNameValue, 0)
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ret
+	}
+	for name, values := range u.Query() {
+		for _, v := range values {
+			ret = append(ret, &HarNameValue{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func harPostData(request *network.Request) string {
+	var sb strings.Builder
+	for _, entry := range request.PostDataEntries {
+		data, err := base64.StdEncoding.DecodeString(entry.Bytes)
+		if err != nil {
+			continue
+		}
+		sb.Write(data)
+	}
+	return sb.String()
+}
+
+func harHttpVersion(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "h2":
+		return "HTTP/2.0"
+	case "h3", "h3-29":
+		return "HTTP/3.0"
+	case "http/1.0":
+		return "HTTP/1.0"
+	case "":
+		return "HTTP/1.1"
+	}
+	return strings.ToUpper(protocol)
+}
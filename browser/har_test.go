@@ -0,0 +1,128 @@
+package browser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+)
+
+func harTimes(offset time.Duration) (*cdp.MonotonicTime, *cdp.TimeSinceEpoch) {
+	monotonic := cdp.MonotonicTime(cdp.MonotonicTimeEpoch.Add(time.Hour + offset))
+	wall := cdp.TimeSinceEpoch(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(offset))
+	return &monotonic, &wall
+}
+
+func harRequestEvent(id, rawUrl string, offset time.Duration) *network.EventRequestWillBeSent {
+	timestamp, wallTime := harTimes(offset)
+	return &network.EventRequestWillBeSent{
+		RequestID: network.RequestID(id),
+		Request: &network.Request{
+			Method:  "GET",
+			URL:     rawUrl,
+			Headers: network.Headers{"Accept": "*/*"},
+		},
+		Timestamp: timestamp,
+		WallTime:  wallTime,
+		Type:      network.ResourceTypeDocument,
+	}
+}
+
+func TestHarEntries(t *testing.T) {
+	r := newHarRecorder(true, 8)
+	page := r.addPage()
+
+	// the redirect completes the first entry, the request id is reused by the target
+	r.onRequest(page.Id, harRequestEvent("1", "http://example.test/old?b=2&a=1", 0))
+	redirect := harRequestEvent("1", "http://example.test/new", 20*time.Millisecond)
+	redirect.RedirectResponse = &network.Response{
+		Status:     302,
+		StatusText: "Found",
+		Protocol:   "http/1.1",
+		Headers:    network.Headers{"Location": "/new"},
+	}
+	r.onRequest(page.Id, redirect)
+	r.onResponse("1", &network.Response{
+		Status:            200,
+		StatusText:        "OK",
+		Protocol:          "h2",
+		MimeType:          "text/html",
+		Headers:           network.Headers{"Set-Cookie": "a=1\nb=2"},
+		EncodedDataLength: 12,
+		RemoteIPAddress:   "[::1]",
+	})
+	finished, _ := harTimes(50 * time.Millisecond)
+	req := r.finish("1", finished, "")
+	if req == nil {
+		t.Fatal("the request is not in flight")
+	}
+	r.setBody(req.entry, []byte("<html></html>"), nil)
+
+	r.onRequest(page.Id, harRequestEvent("2", "http://example.test/small", 10*time.Millisecond))
+	req = r.finish("2", finished, "")
+	r.setBody(req.entry, []byte{0xff, 0xfe}, nil)
+
+	r.onRequest(page.Id, harRequestEvent("3", "http://example.test/gone", 30*time.Millisecond))
+	req = r.finish("3", finished, "net::ERR_FAILED")
+	r.setBody(req.entry, nil, errors.New("no resource"))
+
+	// still in flight, left out of the log
+	r.onRequest(page.Id, harRequestEvent("4", "http://example.test/slow", 40*time.Millisecond))
+	if r.finish("5", finished, "") != nil {
+		t.Error("an unknown request is finished")
+	}
+
+	har := r.build()
+	if page.Title != "http://example.test/old?b=2&a=1" {
+		t.Errorf("page title %q", page.Title)
+	}
+	var urls []string
+	for _, entry := range har.Log.Entries {
+		urls = append(urls, entry.Request.Url)
+	}
+	if got := strings.Join(urls, " "); got != "http://example.test/old?b=2&a=1 http://example.test/small http://example.test/new http://example.test/gone" {
+		t.Fatalf("entries %s", got)
+	}
+	old, small, target, gone := har.Log.Entries[0], har.Log.Entries[1], har.Log.Entries[2], har.Log.Entries[3]
+
+	if old.Response.Status != 302 || old.Response.RedirectURL != "/new" || old.Time != 20 {
+		t.Errorf("redirect status %d, location %q, time %v", old.Response.Status, old.Response.RedirectURL, old.Time)
+	}
+	if q := old.Request.QueryString; len(q) != 2 || q[0].Name != "a" || q[1].Name != "b" {
+		t.Errorf("query string %+v", q)
+	}
+	if target.Response.HttpVersion != "HTTP/2.0" || target.ServerIPAddress != "::1" || target.Response.BodySize != 12 {
+		t.Errorf("response %s from %s, %d bytes", target.Response.HttpVersion, target.ServerIPAddress, target.Response.BodySize)
+	}
+	if h := target.Response.Headers; len(h) != 2 || h[0].Value != "a=1" || h[1].Value != "b=2" {
+		t.Errorf("repeated headers %+v", h)
+	}
+	// the body is over the cap of 8 bytes
+	if c := target.Response.Content; c.Size != 13 || c.Text != "" || !strings.Contains(c.Comment, "exceeds the 8 bytes cap") {
+		t.Errorf("capped content %+v", c)
+	}
+	if c := small.Response.Content; c.Text != "//4=" || c.Encoding != "base64" {
+		t.Errorf("binary content %+v", c)
+	}
+	if gone.Error != "net::ERR_FAILED" || !strings.Contains(gone.Response.Content.Comment, "no resource") {
+		t.Errorf("failed entry %q, %q", gone.Error, gone.Response.Content.Comment)
+	}
+}
+
+func TestHarHttpVersion(t *testing.T) {
+	for protocol, want := range map[string]string{
+		"":         "HTTP/1.1",
+		"http/1.0": "HTTP/1.0",
+		"http/1.1": "HTTP/1.1",
+		"h2":       "HTTP/2.0",
+		"h3":       "HTTP/3.0",
+		"quic":     "QUIC",
+	} {
+		if got := harHttpVersion(protocol); got != want {
+			t.Errorf("%q: %s, want %s", protocol, got, want)
+		}
+	}
+}
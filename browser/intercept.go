@@ -0,0 +1,322 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+type InterceptAction string
+
+const (
+	InterceptBlock          InterceptAction = "block"
+	InterceptAllow          InterceptAction = "allow"
+	InterceptRewriteHeaders InterceptAction = "rewrite_headers"
+)
+
+// one request interception rule, a rule without resource types and url pattern matches every request
+type InterceptRule struct {
+	Action        InterceptAction
+	ResourceTypes []string          // Document, Stylesheet, Image, Media, Font, Script, XHR, Fetch, ...
+	UrlPattern    string            // glob, * matches any characters and ? exactly one
+	Headers       map[string]string // headers set by rewrite_headers, an empty value removes the header
+	urlRegexp     *regexp.Regexp
+}
+
+func (r *InterceptRule) match(url string, resourceType string) bool {
+	if len(r.ResourceTypes) > 0 {
+		found := false
+		for _, t := range r.ResourceTypes {
+			if strings.EqualFold(t, resourceType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.UrlPattern == "" {
+		return true
+	}
+	if r.urlRegexp == nil {
+		r.urlRegexp = globRegexp(r.UrlPattern)
+	}
+	return r.urlRegexp.MatchString(url)
+}
+
+func globRegexp(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, `.*`)
+	expr = strings.ReplaceAll(expr, `\?`, `.`)
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+// counters of intercepted requests
+type InterceptStats struct {
+	Total          int
+	Blocked        int
+	Allowed        int
+	Rewritten      int
+	BlockedByType  map[string]int
+	BlockedByRule  map[int]int // rule index to blocked requests
+	LastBlockedUrl string
+}
+
+type interceptor struct {
+	mu        sync.Mutex
+	enabled   bool            // the rules are applied
+	suspended bool            // another fetch user is active
+	owner     context.Context // the tab of that fetch user
+	policy    *DomainPolicy   // documents on refused domains are blocked, including redirects
+	rules     []*InterceptRule
+	stats     InterceptStats
+}
+
+func (i *interceptor) active() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return !i.suspended && (i.enabled || i.policy != nil)
+}
+
+// the requests of the tab are paused by the fetch user of a suspension
+func (i *interceptor) pausedByOwner(tab context.Context) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.suspended && i.owner == tab
+}
+
+// every request when the rules apply, otherwise only the documents checked by the policy
+func (i *interceptor) patterns() []*fetch.RequestPattern {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.enabled {
+		return []*fetch.RequestPattern{{URLPattern: "*"}}
+	}
+	return []*fetch.RequestPattern{{URLPattern: "*", ResourceType: network.ResourceTypeDocument}}
+}
+
+// the domain policy decides on documents of the main frame, then the first matching block or allow
+// rule decides, headers of every matching rewrite rule before it are applied. iframes like ads and
+// captchas are not navigations of the agent, the policy leaves them to the rules
+func (i *interceptor) decide(url string, resourceType string, mainFrame bool) (bool, map[string]string) {
+	if mainFrame && resourceType == string(network.ResourceTypeDocument) {
+		if e := i.policy.Check(url); e != nil {
+			i.policy.record(e)
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			i.stats.Total++
+			i.stats.Blocked++
+			i.stats.BlockedByType[resourceType]++
+			i.stats.LastBlockedUrl = url
+			return false, nil
+		}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.enabled {
+		return true, nil
+	}
+	i.stats.Total++
+	var headers map[string]string
+	for idx, rule := range i.rules {
+		if !rule.match(url, resourceType) {
+			continue
+		}
+		if rule.Action == InterceptRewriteHeaders {
+			if headers == nil {
+				headers = make(map[string]string)
+			}
+			for k, v := range rule.Headers {
+				headers[k] = v
+			}
+			continue
+		}
+		if rule.Action == InterceptBlock {
+			i.stats.Blocked++
+			i.stats.BlockedByType[resourceType]++
+			i.stats.BlockedByRule[idx]++
+			i.stats.LastBlockedUrl = url
+			return false, nil
+		}
+		break
+	}
+	i.stats.Allowed++
+	if headers != nil {
+		i.stats.Rewritten++
+	}
+	return true, headers
+}
+
+func (b *Browser) getInterceptor() *interceptor {
+	if b.interceptor == nil {
+		b.interceptor = &interceptor{
+			enabled: len(b.Config.InterceptRules) > 0,
+			policy:  b.policy,
+			rules:   b.Config.InterceptRules,
+			stats: InterceptStats{
+				BlockedByType: make(map[string]int),
+				BlockedByRule: make(map[int]int),
+			},
+		}
+	}
+	return b.interceptor
+}
+
+// turn request interception on or off for every tab of the session
+func (b *Browser) SetRequestInterception(enabled bool) error {
+	i := b.getInterceptor()
+	i.mu.Lock()
+	i.enabled = enabled
+	i.mu.Unlock()
+	for _, tab := range b.tabs {
+		if err := b.applyInterception(tab); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replace the interception rules, they apply to requests paused from now on
+func (b *Browser) SetInterceptRules(rules []*InterceptRule) {
+	i := b.getInterceptor()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = rules
+}
+
+func (b *Browser) GetInterceptStats() InterceptStats {
+	i := b.getInterceptor()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	stats := i.stats
+	stats.BlockedByType = make(map[string]int)
+	for k, v := range i.stats.BlockedByType {
+		stats.BlockedByType[k] = v
+	}
+	stats.BlockedByRule = make(map[int]int)
+	for k, v := range i.stats.BlockedByRule {
+		stats.BlockedByRule[k] = v
+	}
+	return stats
+}
+
+// listen for paused requests of a new tab, interception itself is switched by applyInterception
+func (b *Browser) listenInterception(tab context.Context) {
+	i := b.getInterceptor()
+	chromedp.ListenTarget(tab, func(ev any) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// responding from the listener goroutine would dead lock
+		go func() {
+			c := chromedp.FromContext(tab)
+			ctx := cdp.WithExecutor(tab, c.Target)
+			if !i.active() {
+				if i.pausedByOwner(tab) {
+					// paused by another fetch user, e.g. LoadStorageState
+					return
+				}
+				// paused before interception was switched off
+				_ = fetch.ContinueRequest(paused.RequestID).Do(ctx)
+				return
+			}
+			// the main frame of a page target has the id of the target
+			mainFrame := string(paused.FrameID) == string(c.Target.TargetID)
+			allowed, headers := i.decide(paused.Request.URL, string(paused.ResourceType), mainFrame)
+			if !allowed {
+				_ = fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+				return
+			}
+			continueParams := fetch.ContinueRequest(paused.RequestID)
+			if headers != nil {
+				continueParams = continueParams.WithHeaders(rewriteHeaders(paused.Request.Headers, headers))
+			}
+			_ = continueParams.Do(ctx)
+		}()
+	})
+}
+
+// stop interception while another fetch user is active in the owner tab, the returned func turns
+// it back on. fetch is disabled in every tab meanwhile, so no request waits for the resume
+func (b *Browser) suspendInterception(owner context.Context) (func() error, error) {
+	i := b.getInterceptor()
+	i.mu.Lock()
+	i.suspended = true
+	i.owner = owner
+	i.mu.Unlock()
+	resume := func() error {
+		i.mu.Lock()
+		i.suspended = false
+		i.owner = nil
+		i.mu.Unlock()
+		for _, tab := range b.tabs {
+			if err := b.applyInterception(tab); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, tab := range b.tabs {
+		if err := b.applyInterception(tab); err != nil {
+			return nil, errors.Join(err, resume())
+		}
+	}
+	return resume, nil
+}
+
+// prepare a newly tracked tab
+func (b *Browser) setupTab(tab context.Context) error {
+	b.listenHar(tab)
+	b.listenConsole(tab)
+	b.listenInterception(tab)
+	return b.applyInterception(tab)
+}
+
+func (b *Browser) applyInterception(tab context.Context) error {
+	i := b.getInterceptor()
+	var action chromedp.Action = fetch.Disable()
+	if i.active() {
+		action = fetch.Enable().WithPatterns(i.patterns())
+	}
+	if err := chromedp.Run(tab, action); err != nil {
+		return fmt.Errorf("switch request interception: %w", err)
+	}
+	return nil
+}
+
+func rewriteHeaders(original network.Headers, overrides map[string]string) []*fetch.HeaderEntry {
+	entries := make([]*fetch.HeaderEntry, 0, len(original)+len(overrides))
+	for name, value := range original {
+		if _, ok := lookupHeader(overrides, name); ok {
+			continue
+		}
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: fmt.Sprint(value)})
+	}
+	for name, value := range overrides {
+		if value == "" {
+			continue
+		}
+		entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+	}
+	return entries
+}
+
+// header names are case insensitive
+func lookupHeader(headers map[string]string, name string) (string, bool) {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package browser
+
+import (
+	"os"
+	"testing"
+)
+
+func newTestInterceptor(policy *DomainPolicy, rules []*InterceptRule) *interceptor {
+	return &interceptor{
+		enabled: len(rules) > 0,
+		policy:  policy,
+		rules:   rules,
+		stats: InterceptStats{
+			BlockedByType: make(map[string]int),
+			BlockedByRule: make(map[int]int),
+		},
+	}
+}
+
+func TestDecideDomainPolicyMainFrameOnly(t *testing.T) {
+	policy := NewDomainPolicy([]string{"example.com"}, []string{"evil.example.com"})
+	i := newTestInterceptor(policy, nil)
+	tests := []struct {
+		name         string
+		url          string
+		resourceType string
+		mainFrame    bool
+		allowed      bool
+	}{
+		{"allowed page", "https://www.example.com/", "Document", true, true},
+		{"page off the allowlist", "https://other.org/", "Document", true, false},
+		{"denied page", "https://evil.example.com/", "Document", true, false},
+		{"third party iframe", "https://www.youtube.com/embed/x", "Document", false, true},
+		{"denied iframe", "https://evil.example.com/frame", "Document", false, true},
+		{"script of another domain", "https://cdn.other.org/app.js", "Script", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := policy.violationCount()
+			allowed, _ := i.decide(tt.url, tt.resourceType, tt.mainFrame)
+			if allowed != tt.allowed {
+				t.Errorf("decide(%s) allowed = %v, want %v", tt.url, allowed, tt.allowed)
+			}
+			// only refused navigations of the page are reported to actions
+			recorded := policy.violationSince(before) != nil
+			if recorded == tt.allowed {
+				t.Errorf("decide(%s) recorded a violation = %v", tt.url, recorded)
+			}
+		})
+	}
+	if stats := i.stats; stats.Blocked != 2 || stats.LastBlockedUrl != "https://evil.example.com/" {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestDecideRulesApplyToIframes(t *testing.T) {
+	policy := NewDomainPolicy([]string{"example.com"}, nil)
+	i := newTestInterceptor(policy, []*InterceptRule{
+		{Action: InterceptBlock, ResourceTypes: []string{"Document"}, UrlPattern: "https://ads.*"},
+	})
+	if allowed, _ := i.decide("https://ads.tracker.net/frame", "Document", false); allowed {
+		t.Error("the iframe matching a block rule is allowed")
+	}
+	if policy.violationCount() != 0 {
+		t.Error("an iframe blocked by a rule is recorded as a navigation violation")
+	}
+	if i.stats.BlockedByRule[0] != 1 {
+		t.Errorf("stats %+v", i.stats)
+	}
+}
+
+// setting up the first tab starts chrome, its failure is returned and a later action tries again
+// hide chrome from chromedp
+func withoutChrome(t *testing.T) {
+	// chromedp looks at these paths besides PATH
+	for _, path := range []string{"/usr/bin/google-chrome", "/usr/local/bin/chrome", "/snap/bin/chromium"} {
+		if _, err := os.Stat(path); err == nil {
+			t.Skip("chrome is installed outside of PATH")
+		}
+	}
+	t.Setenv("PATH", t.TempDir())
+}
+
+func TestStartWithoutChrome(t *testing.T) {
+	withoutChrome(t)
+	b := NewBrowser()
+	if err := b.Start(); err == nil {
+		t.Fatal("started without chrome")
+	}
+	if b.ctx != nil || b.current != nil || len(b.tabs) != 0 {
+		t.Error("the failed start is kept")
+	}
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: "about:blank"}); err == nil {
+		t.Error("navigated without chrome")
+	}
+}
@@ -0,0 +1,58 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+// one record per action with the tab and url it ran on, err points to the action's result
+func (b *Browser) logAction(action string, param any, start time.Time, err *error) {
+	var actionErr error
+	if err != nil {
+		actionErr = *err
+	}
+	level := slog.LevelInfo
+	if actionErr != nil {
+		level = slog.LevelError
+	}
+	if !b.Logger.Enabled(context.Background(), level) {
+		return
+	}
+	attrs := make([]any, 0, 2)
+	if b.current != nil {
+		if c := chromedp.FromContext(b.current); c != nil && c.Target != nil && c.Browser != nil {
+			attrs = append(attrs, slog.String("tab", c.Target.TargetID.String()))
+			ctx := cdp.WithExecutor(b.current, c.Browser)
+			if info, e := target.GetTargetInfo().WithTargetID(c.Target.TargetID).Do(ctx); e == nil {
+				attrs = append(attrs, slog.String("url", info.URL))
+			}
+		}
+	}
+	controller.LogAction(b.Logger, action, param, b.SensitiveData, time.Since(start), actionErr, attrs...)
+}
+
+// chromedp's own logs go to the browser logger. they are options of the browser connection,
+// only the context allocating the browser can take them
+func (b *Browser) chromedpLogOptions() []chromedp.ContextOption {
+	logf := func(level slog.Level) func(string, ...any) {
+		return func(format string, args ...any) {
+			// debug logs carry every cdp message, format them only when wanted
+			if !b.Logger.Enabled(context.Background(), level) {
+				return
+			}
+			b.Logger.Log(context.Background(), level, fmt.Sprintf(format, args...), "source", "chromedp")
+		}
+	}
+	return []chromedp.ContextOption{
+		chromedp.WithLogf(logf(slog.LevelInfo)),
+		chromedp.WithErrorf(logf(slog.LevelError)),
+		chromedp.WithDebugf(logf(slog.LevelDebug)),
+	}
+}
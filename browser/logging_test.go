@@ -0,0 +1,47 @@
+package browser
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// the log options of the browser connection cover the tabs opened later
+func TestChromedpLogsWithTabs(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	var out syncBuffer
+	config := DefaultBrowserConfig()
+	config.Logger = slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	b := NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.GoToUelrlNewTab(&GoToUrlNewTabParam{Url: "about:blank"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.tabs) != 2 {
+		t.Fatalf("%d tabs", len(b.tabs))
+	}
+	if !strings.Contains(out.String(), "source=chromedp") {
+		t.Error("chromedp does not log to the browser logger")
+	}
+}
@@ -0,0 +1,100 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+// paper sizes in inches, width then height in portrait
+var paperFormats = map[string][2]float64{
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+	"ledger":  {17, 11},
+	"a0":      {33.1, 46.8},
+	"a1":      {23.4, 33.1},
+	"a2":      {16.54, 23.4},
+	"a3":      {11.7, 16.54},
+	"a4":      {8.27, 11.7},
+	"a5":      {5.83, 8.27},
+	"a6":      {4.13, 5.83},
+}
+
+// print the current page to a pdf file of the workspace, the path is returned in the result.
+// chrome prints only when it runs headless, a headful browser is refused before anything is done
+func (b *Browser) SaveAsPDF(param *SaveAsPDFParam) (result *controller.ActionResult, err error) {
+	defer b.logAction("save_pdf", param, time.Now(), &err)
+	if !b.Config.Headless {
+		return nil, errors.New("saving as pdf needs chrome running headless, the browser is started with a window")
+	}
+	name := param.Path
+	if name == "" {
+		name = fmt.Sprintf("page-%d.pdf", time.Now().UnixMilli())
+	} else if !strings.EqualFold(filepath.Ext(name), ".pdf") {
+		name += ".pdf"
+	}
+	path, err := b.workspacePath(name)
+	if err != nil {
+		return nil, err
+	}
+	params := page.PrintToPDF().
+		WithLandscape(param.Landscape).
+		WithPrintBackground(param.PrintBackground).
+		WithPageRanges(param.PageRanges)
+	width, height := param.PaperWidth, param.PaperHeight
+	if width <= 0 || height <= 0 {
+		format := strings.ToLower(param.PaperFormat)
+		if format == "" {
+			format = "letter"
+		}
+		size, ok := paperFormats[format]
+		if !ok {
+			return nil, fmt.Errorf("unknown paper format %q", param.PaperFormat)
+		}
+		width, height = size[0], size[1]
+	}
+	params = params.WithPaperWidth(width).WithPaperHeight(height)
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = chromedp.Run(tab, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		data, _, err = params.Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+	return &controller.ActionResult{
+		ExtractedContent: fmt.Sprintf("Saved the page as pdf to %s", path),
+		IncludeInMemory:  true,
+		Attachments:      []string{path},
+	}, nil
+}
+
+type SaveAsPDFParam struct {
+	Path            string  // file in the workspace, a timestamped name when empty
+	PaperFormat     string  // letter, legal, tabloid, ledger or a0 to a6, letter when empty
+	PaperWidth      float64 // inches, with PaperHeight it takes precedence over the format
+	PaperHeight     float64
+	Landscape       bool
+	PrintBackground bool   // print background colors and images
+	PageRanges      string // like "1-5, 8, 11-13", every page when empty
+}
@@ -0,0 +1,64 @@
+package browser
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSaveAsPDFHeadful(t *testing.T) {
+	config := DefaultBrowserConfig()
+	config.Headless = false
+	config.WorkspaceDir = t.TempDir()
+	b := NewBrowserWithConfig(config)
+	defer b.Close()
+	_, err := b.SaveAsPDF(&SaveAsPDFParam{Path: "page.pdf"})
+	if err == nil || !strings.Contains(err.Error(), "headless") {
+		t.Fatalf("a headful browser prints, %v", err)
+	}
+	if b.ctx != nil {
+		t.Error("the browser is started before the refusal")
+	}
+	if entries, _ := os.ReadDir(config.WorkspaceDir); len(entries) != 0 {
+		t.Errorf("%d files written", len(entries))
+	}
+}
+
+func TestSaveAsPDF(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body><h1>receipt</h1></body></html>`))
+	}))
+	defer server.Close()
+	config := DefaultBrowserConfig()
+	config.Headless = true
+	config.WorkspaceDir = t.TempDir()
+	b := NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.SaveAsPDF(&SaveAsPDFParam{PaperFormat: "b5"}); err == nil {
+		t.Error("an unknown paper format is accepted")
+	}
+	result, err := b.SaveAsPDF(&SaveAsPDFParam{Path: "receipts/march", PaperFormat: "A4", Landscape: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Attachments) != 1 || !strings.HasSuffix(result.Attachments[0], "march.pdf") {
+		t.Fatalf("attachments %v", result.Attachments)
+	}
+	data, err := os.ReadFile(result.Attachments[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Errorf("not a pdf, %q", data[:min(len(data), 8)])
+	}
+}
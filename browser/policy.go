@@ -0,0 +1,234 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// navigation refused by the domain allowlist or denylist
+type NavigationPolicyError struct {
+	Url    string
+	Domain string
+	Reason string
+}
+
+func (e *NavigationPolicyError) Error() string {
+	return fmt.Sprintf("navigation to %s is not allowed: domain %s %s", e.Url, e.Domain, e.Reason)
+}
+
+// domain patterns are either a domain, matching itself and its subdomains,
+// or a glob like *.example.com matched against the host
+type DomainPolicy struct {
+	AllowedDomains []string // empty allows every domain that is not denied
+	DeniedDomains  []string // takes precedence over AllowedDomains
+
+	mu            sync.Mutex
+	lastViolation *NavigationPolicyError
+	violations    int
+	refused       map[string]bool // popup targets closed for their domain
+}
+
+func NewDomainPolicy(allowed []string, denied []string) *DomainPolicy {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil
+	}
+	return &DomainPolicy{
+		AllowedDomains: allowed,
+		DeniedDomains:  denied,
+	}
+}
+
+// check the url, only http and websocket urls are subject to the policy
+func (p *DomainPolicy) Check(rawUrl string) *NavigationPolicyError {
+	if p == nil {
+		return nil
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return &NavigationPolicyError{Url: rawUrl, Reason: "can not be parsed"}
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range p.DeniedDomains {
+		if matchDomain(pattern, host) {
+			return &NavigationPolicyError{Url: rawUrl, Domain: host, Reason: "is denied by " + pattern}
+		}
+	}
+	if len(p.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowedDomains {
+		if matchDomain(pattern, host) {
+			return nil
+		}
+	}
+	return &NavigationPolicyError{Url: rawUrl, Domain: host, Reason: "is not in the allowed domains"}
+}
+
+func matchDomain(pattern string, host string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if strings.Contains(pattern, "*") {
+		return globRegexp(pattern).MatchString(host)
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// remember a refused navigation, actions report it to the agent
+func (p *DomainPolicy) record(e *NavigationPolicyError) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastViolation = e
+	p.violations++
+}
+
+// mark the popup target as refused, false when it already is
+func (p *DomainPolicy) refuseTarget(targetId string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refused[targetId] {
+		return false
+	}
+	if p.refused == nil {
+		p.refused = make(map[string]bool)
+	}
+	p.refused[targetId] = true
+	return true
+}
+
+func (p *DomainPolicy) isRefusedTarget(targetId string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.refused[targetId]
+}
+
+// number of violations so far, to find the ones happening during an action
+func (p *DomainPolicy) violationCount() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.violations
+}
+
+// the latest violation if any happened after count
+func (p *DomainPolicy) violationSince(count int) *NavigationPolicyError {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.violations == count {
+		return nil
+	}
+	return p.lastViolation
+}
+
+// as an error interface, nil when there was no violation
+func (b *Browser) policyViolationSince(count int) error {
+	if e := b.policy.violationSince(count); e != nil {
+		return e
+	}
+	return nil
+}
+
+// check a url before navigating to it
+func (b *Browser) checkNavigation(rawUrl string) error {
+	if e := b.policy.Check(rawUrl); e != nil {
+		b.policy.record(e)
+		return e
+	}
+	return nil
+}
+
+// close new tabs and popups opened on a refused domain, whoever opened them
+func (b *Browser) listenTargets() {
+	if b.policy == nil {
+		return
+	}
+	ctx := b.ctx
+	chromedp.ListenBrowser(ctx, func(ev any) {
+		var info *target.Info
+		switch ev := ev.(type) {
+		case *target.EventTargetCreated:
+			info = ev.TargetInfo
+		case *target.EventTargetInfoChanged:
+			info = ev.TargetInfo
+		default:
+			return
+		}
+		if info.Type != "page" || info.OpenerID == "" {
+			// tabs of the browser are guarded by request interception, here only popups are handled
+			return
+		}
+		e := b.policy.Check(info.URL)
+		if e == nil || !b.policy.refuseTarget(string(info.TargetID)) {
+			return
+		}
+		b.policy.record(e)
+		// commands can not wait for their answer in the listener
+		go func() {
+			_ = closeTarget(ctx, info.TargetID)
+		}()
+	})
+}
+
+// close the target through the browser connection of ctx
+func closeTarget(ctx context.Context, targetId target.ID) error {
+	c := chromedp.FromContext(ctx)
+	return target.CloseTarget(targetId).Do(cdp.WithExecutor(ctx, c.Browser))
+}
+
+// attach the tabs opened since the known ones, popups on refused domains are closed first.
+// the listener of listenTargets may not have seen a popup yet, so its url is checked here too
+func (b *Browser) attachNewTabs() ([]context.Context, error) {
+	tabs, err := b.getChromeDpTabs()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range b.tabs {
+		delete(tabs, chromedp.FromContext(c).Target.TargetID.String())
+	}
+	ids := make([]string, 0, len(tabs))
+	for id := range tabs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	attached := make([]context.Context, 0, len(ids))
+	for _, id := range ids {
+		if b.policy.isRefusedTarget(id) {
+			continue
+		}
+		if e := b.policy.Check(tabs[id].Url); e != nil {
+			if b.policy.refuseTarget(id) {
+				b.policy.record(e)
+			}
+			if err := closeTarget(b.ctx, target.ID(id)); err != nil {
+				b.Logger.Debug("close refused popup", "target", id, "error", err)
+			}
+			continue
+		}
+		ctx, _ := chromedp.NewContext(b.ctx, chromedp.WithTargetID(target.ID(id)))
+		b.tabs = append(b.tabs, ctx)
+		if err := b.setupTab(ctx); err != nil {
+			return attached, err
+		}
+		attached = append(attached, ctx)
+	}
+	return attached, nil
+}
@@ -0,0 +1,147 @@
+package browser
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClickPopups(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body>
+			<a id="denied" href="http://denied.test/" target="_blank">denied</a>
+			<a id="allowed" href="/popup" target="_blank">allowed</a>
+			<button id="noop">noop</button>
+		</body></html>`))
+	}))
+	defer server.Close()
+	config := DefaultBrowserConfig()
+	config.AllowedDomains = []string{"127.0.0.1"}
+	b := NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	count := b.policy.violationCount()
+	err := b.ClickElement(&ClickElementParam{Selector: "#denied"})
+	var policyErr *NavigationPolicyError
+	if err != nil && !errors.As(err, &policyErr) {
+		t.Fatal(err)
+	}
+	// the listener may refuse the popup after the click returned
+	for deadline := time.Now().Add(5 * time.Second); b.policy.violationSince(count) == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("the popup is not refused")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := b.ClickElement(&ClickElementParam{Selector: "#noop"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.tabs) != 1 {
+		t.Fatalf("%d tabs after the refused popup", len(b.tabs))
+	}
+
+	if err := b.ClickElement(&ClickElementParam{Selector: "#allowed"}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(b.tabs) == 1; {
+		if time.Now().After(deadline) {
+			t.Fatal("the popup is not attached")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := b.ClickElement(&ClickElementParam{Selector: "#noop"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tabs, current, err := b.getTabsInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tabs) != 2 || current.PageId != 1 {
+		t.Errorf("tabs %d, current %d", len(tabs), current.PageId)
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "www.example.com", true},
+		{"example.com", "a.b.example.com", true},
+		{"example.com", "notexample.com", false},
+		{"example.com", "example.com.evil.test", false},
+		{" Example.COM ", "example.com", true},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "www.example.org", false},
+		{"shop.*", "shop.example.com", true},
+		{"shop.*", "www.shop.example.com", false},
+		{"*", "anything.test", true},
+	}
+	for _, tt := range tests {
+		if got := matchDomain(tt.pattern, tt.host); got != tt.want {
+			t.Errorf("matchDomain(%q, %q) = %v, want %v", tt.pattern, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestDomainPolicyCheck(t *testing.T) {
+	policy := NewDomainPolicy([]string{"example.com", "*.test", "127.0.0.1"}, []string{"ads.example.com", "*.evil.test"})
+	tests := []struct {
+		url    string
+		reason string // empty when allowed
+	}{
+		{"https://example.com/path", ""},
+		{"https://www.example.com:8443/path", ""},
+		{"http://EXAMPLE.com:80", ""},
+		{"http://127.0.0.1:8080/", ""},
+		{"ws://chat.test:9000/socket", ""},
+		{"https://ads.example.com/banner", "is denied by ads.example.com"},
+		{"https://cdn.ads.example.com:8443/banner", "is denied by ads.example.com"},
+		{"https://www.evil.test/", "is denied by *.evil.test"},
+		{"https://example.org/", "is not in the allowed domains"},
+		{"http://127.0.0.2:8080/", "is not in the allowed domains"},
+		{"http://%zz", "can not be parsed"},
+		// only http and websocket urls are subject to the policy
+		{"about:blank", ""},
+		{"data:text/html,hello", ""},
+		{"chrome://settings", ""},
+	}
+	for _, tt := range tests {
+		err := policy.Check(tt.url)
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Errorf("%s is refused: %v", tt.url, err)
+		case tt.reason != "" && err == nil:
+			t.Errorf("%s is allowed", tt.url)
+		case tt.reason != "" && err.Reason != tt.reason:
+			t.Errorf("%s is refused as %q, want %q", tt.url, err.Reason, tt.reason)
+		}
+	}
+
+	if NewDomainPolicy(nil, nil) != nil {
+		t.Error("a policy without domains is not nil")
+	}
+	var none *DomainPolicy
+	if err := none.Check("https://example.org/"); err != nil {
+		t.Errorf("the nil policy refuses %v", err)
+	}
+	denyOnly := NewDomainPolicy(nil, []string{"example.org"})
+	if err := denyOnly.Check("https://example.com/"); err != nil {
+		t.Errorf("the deny list refuses %v", err)
+	}
+	if err := denyOnly.Check("https://www.example.org:8080/"); err == nil || err.Domain != "www.example.org" {
+		t.Errorf("the denied domain is %v", err)
+	}
+}
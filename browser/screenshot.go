@@ -0,0 +1,270 @@
+package browser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	ScreenshotFormatPng  = "png"
+	ScreenshotFormatJpeg = "jpeg"
+)
+
+// area of the page in css pixels, relative to the top left of the document
+type ScreenshotClip struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// what a screenshot captures and how it is encoded, ElementIndex and Clip take precedence over FullPage
+type ScreenshotOptions struct {
+	FullPage     bool            // the whole page instead of the viewport
+	Format       string          // ScreenshotFormatPng when empty, or ScreenshotFormatJpeg
+	Quality      int             // jpeg quality, 90 when 0
+	MaxWidth     int             // wider images are scaled down to this width, 0 keeps the device pixels
+	Clip         *ScreenshotClip // only this area of the page
+	ElementIndex *int            // only the element with this highlight index of the cached state
+}
+
+// the state screenshot as it always was, the full page in jpeg
+func DefaultScreenshotOptions() *ScreenshotOptions {
+	return &ScreenshotOptions{
+		FullPage: true,
+		Format:   ScreenshotFormatJpeg,
+		Quality:  90,
+	}
+}
+
+// screenshot of the current tab, DefaultScreenshotOptions when options is nil
+func (b *Browser) TakeScreenshot(options *ScreenshotOptions) ([]byte, error) {
+	return b.screenshot(options, nil)
+}
+
+// the elements are drawn on viewport and full page screenshots when given
+func (b *Browser) screenshot(options *ScreenshotOptions, elements SelectorMap) ([]byte, error) {
+	if options == nil {
+		options = DefaultScreenshotOptions()
+	}
+	format := page.CaptureScreenshotFormatPng
+	switch options.Format {
+	case "", ScreenshotFormatPng:
+	case ScreenshotFormatJpeg:
+		format = page.CaptureScreenshotFormatJpeg
+	default:
+		return nil, fmt.Errorf("unknown screenshot format %q", options.Format)
+	}
+	quality := options.Quality
+	if quality <= 0 {
+		quality = 90
+	}
+	annotate := len(elements) > 0 && options.Clip == nil && options.ElementIndex == nil
+	if !annotate && options.MaxWidth <= 0 {
+		data, _, err := b.captureScreenshot(options, format, quality)
+		return data, err
+	}
+	// captured lossless, the image is encoded once after drawing and scaling
+	data, clip, err := b.captureScreenshot(options, page.CaptureScreenshotFormatPng, 0)
+	if err != nil {
+		return nil, err
+	}
+	src, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode screenshot: %w", err)
+	}
+	img := toRGBA(src)
+	if annotate {
+		// the screenshot has device pixels
+		annotateImage(img, elements, options.FullPage, float64(img.Bounds().Dx())/clip.Width)
+	}
+	if options.MaxWidth > 0 && img.Bounds().Dx() > options.MaxWidth {
+		img = downscale(img, options.MaxWidth)
+	}
+	return encodeImage(img, string(format), quality)
+}
+
+// capture the area the options select, the image and the area in css pixels of the page
+func (b *Browser) captureScreenshot(options *ScreenshotOptions, format page.CaptureScreenshotFormat, quality int) ([]byte, *ScreenshotClip, error) {
+	var clip *ScreenshotClip
+	// element boxes are in viewport coordinates
+	viewportRelative := false
+	if options.ElementIndex != nil {
+		node, err := b.getIndexElement(*options.ElementIndex)
+		if err != nil {
+			return nil, nil, err
+		}
+		frame, backendNodeId, err := b.locateElement(node)
+		if err != nil {
+			return nil, nil, err
+		}
+		x, y, width, height, err := b.getElementBox(frame, backendNodeId)
+		if err != nil {
+			return nil, nil, err
+		}
+		clip = &ScreenshotClip{X: x, Y: y, Width: width, Height: height}
+		viewportRelative = true
+	} else if options.Clip != nil {
+		c := *options.Clip
+		clip = &c
+	}
+	tab, err := b.getCurrentPage()
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []byte
+	err = chromedp.Run(tab, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, _, _, _, viewport, content, err := page.GetLayoutMetrics().Do(ctx)
+		if err != nil {
+			return err
+		}
+		beyondViewport := true
+		switch {
+		case clip != nil && viewportRelative:
+			clip.X += viewport.PageX
+			clip.Y += viewport.PageY
+		case clip != nil:
+		case options.FullPage:
+			clip = &ScreenshotClip{Width: content.Width, Height: content.Height}
+		default:
+			clip = &ScreenshotClip{X: viewport.PageX, Y: viewport.PageY, Width: viewport.ClientWidth, Height: viewport.ClientHeight}
+			beyondViewport = false
+		}
+		if clip.Width <= 0 || clip.Height <= 0 {
+			return errors.New("the screenshot area is empty")
+		}
+		params := page.CaptureScreenshot().
+			WithFormat(format).
+			WithCaptureBeyondViewport(beyondViewport).
+			WithClip(&page.Viewport{X: clip.X, Y: clip.Y, Width: clip.Width, Height: clip.Height, Scale: 1})
+		if format == page.CaptureScreenshotFormatJpeg {
+			params = params.WithQuality(int64(quality))
+		}
+		out, err = params.Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, clip, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if img, ok := src.(*image.RGBA); ok {
+		return img
+	}
+	img := image.NewRGBA(src.Bounds())
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+	return img
+}
+
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var out bytes.Buffer
+	var err error
+	if format == ScreenshotFormatJpeg {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&out, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// scale the image down to the width keeping its aspect, a pixel is the average of the pixels it covers
+func downscale(src *image.RGBA, width int) *image.RGBA {
+	bounds := src.Bounds()
+	height := max(1, int(math.Round(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()))))
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+			var sum [4]int
+			n := 0
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(src.Pix[i+c])
+					}
+					i += 4
+					n++
+				}
+			}
+			j := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[j+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// path of a file in the workspace, names leaving the workspace are refused
+func (b *Browser) workspacePath(name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%q is not a path inside the workspace", name)
+	}
+	dir := b.Config.WorkspaceDir
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// save a screenshot to a file of the workspace, the format follows the extension. the path is returned
+func (b *Browser) SaveScreenshot(param *ScreenshotParam) (path string, err error) {
+	defer b.logAction("screenshot", param, time.Now(), &err)
+	name := param.Path
+	if name == "" {
+		name = fmt.Sprintf("screenshot-%d.png", time.Now().UnixMilli())
+	}
+	path, err = b.workspacePath(name)
+	if err != nil {
+		return "", err
+	}
+	options := &ScreenshotOptions{
+		FullPage:     param.FullPage,
+		Format:       ScreenshotFormatPng,
+		ElementIndex: param.Index,
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		options.Format = ScreenshotFormatJpeg
+	}
+	data, err := b.TakeScreenshot(options)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+type ScreenshotParam struct {
+	FullPage bool
+	Index    *int   // only the element with this index
+	Path     string // file in the workspace, .png or .jpg, a timestamped png when empty
+}
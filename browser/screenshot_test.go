@@ -0,0 +1,81 @@
+package browser
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspacePath(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		workspace string
+		name      string
+		want      string // empty when refused
+	}{
+		{dir, "shot.png", filepath.Join(dir, "shot.png")},
+		{dir, "receipts/march.pdf", filepath.Join(dir, "receipts", "march.pdf")},
+		{dir, "a/../shot.png", filepath.Join(dir, "shot.png")},
+		{"", "shot.png", "shot.png"},
+		{dir, "../shot.png", ""},
+		{dir, "a/../../shot.png", ""},
+		{dir, "/etc/passwd", ""},
+		{dir, "", ""},
+	}
+	for _, tt := range tests {
+		config := DefaultBrowserConfig()
+		config.WorkspaceDir = tt.workspace
+		b := NewBrowserWithConfig(config)
+		got, err := b.workspacePath(tt.name)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%q in %q is accepted as %s", tt.name, tt.workspace, got)
+		case tt.want != "" && err != nil:
+			t.Errorf("%q in %q: %v", tt.name, tt.workspace, err)
+		case got != tt.want:
+			t.Errorf("%q in %q is %s, want %s", tt.name, tt.workspace, got, tt.want)
+		}
+	}
+}
+
+// the path is checked before a browser is needed
+func TestSaveScreenshotOutsideWorkspace(t *testing.T) {
+	config := DefaultBrowserConfig()
+	config.WorkspaceDir = t.TempDir()
+	b := NewBrowserWithConfig(config)
+	if _, err := b.SaveScreenshot(&ScreenshotParam{Path: "../escape.png"}); err == nil {
+		t.Error("a screenshot is saved outside the workspace")
+	}
+	if b.ctx != nil {
+		t.Error("the browser is started for a refused path")
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	// left half black, right half white
+	src := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			c := color.RGBA{0, 0, 0, 0xFF}
+			if x >= 4 {
+				c = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+	dst := downscale(src, 4)
+	if got := dst.Bounds(); got != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("bounds %v", got)
+	}
+	if got := dst.RGBAAt(1, 1); got != (color.RGBA{0, 0, 0, 0xFF}) {
+		t.Errorf("left pixel %v", got)
+	}
+	if got := dst.RGBAAt(2, 0); got != (color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("right pixel %v", got)
+	}
+	// a pixel over both halves is their average
+	if got := downscale(src, 1).RGBAAt(0, 0); got != (color.RGBA{0x7F, 0x7F, 0x7F, 0xFF}) {
+		t.Errorf("averaged pixel %v", got)
+	}
+}
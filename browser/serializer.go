@@ -0,0 +1,263 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// formats the dom tree for the model
+type DomSerializer interface {
+	Serialize(root *DomElementNode) (string, error)
+}
+
+// attributes given to the model by default, in output order
+var DefaultIncludeAttributes = []string{
+	"title",
+	"type",
+	"name",
+	"role",
+	"tabindex",
+	"aria-label",
+	"placeholder",
+	"value",
+	"alt",
+	"aria-expanded",
+}
+
+type SerializeOptions struct {
+	IncludeAttributes  []string // attribute whitelist in output order, nil for DefaultIncludeAttributes
+	MaxTextLength      int      // characters of text per element or text line, 0 for no limit
+	CollapseWhitespace bool     // runs of whitespace and newlines become one space
+	MaxChars           int      // budget of the whole output, the rest is replaced by a truncation marker, 0 for no limit
+}
+
+func DefaultSerializeOptions() SerializeOptions {
+	return SerializeOptions{
+		IncludeAttributes: DefaultIncludeAttributes,
+	}
+}
+
+const (
+	DomFormatCompact = "compact"
+	DomFormatJson    = "json"
+	DomFormatHtml    = "html"
+)
+
+func NewDomSerializer(format string, options SerializeOptions) (DomSerializer, error) {
+	switch format {
+	case DomFormatCompact, "":
+		return &CompactSerializer{options}, nil
+	case DomFormatJson:
+		return &JsonSerializer{options}, nil
+	case DomFormatHtml:
+		return &HtmlSerializer{options}, nil
+	}
+	return nil, fmt.Errorf("unknown dom format %s, expected compact, json or html", format)
+}
+
+// one line of output, an interactive element or text giving context
+type domEntry struct {
+	node       *DomElementNode // nil for text
+	text       string
+	attributes [][2]string // name and value, in whitelist order
+}
+
+// interactive elements and visible text outside of them, in document order
+func (o *SerializeOptions) entries(root *DomElementNode) []*domEntry {
+	includeAttributes := o.IncludeAttributes
+	if includeAttributes == nil {
+		includeAttributes = DefaultIncludeAttributes
+	}
+	entries := make([]*domEntry, 0)
+	var processFn func(node DomNodeI)
+	processFn = func(node DomNodeI) {
+		if eNode, ok := node.(*DomElementNode); ok {
+			if eNode.HighlightIndex != nil {
+				entry := &domEntry{
+					node: eNode,
+					text: o.formatText(eNode.getAllTextTillNextClickableElement(-1)),
+				}
+				for _, key := range includeAttributes {
+					val, ok := eNode.Attributes[key]
+					if !ok || val == "" || val == eNode.TagName {
+						continue
+					}
+					entry.attributes = append(entry.attributes, [2]string{key, o.formatText(val)})
+				}
+				entries = append(entries, entry)
+			}
+			for _, child := range eNode.Childrens {
+				processFn(child)
+			}
+		} else if tNode, ok := node.(*DomTextNode); ok {
+			if tNode.IsVisvable && !tNode.hasParentWithHighlight() {
+				if text := o.formatText(tNode.Text); text != "" {
+					entries = append(entries, &domEntry{text: text})
+				}
+			}
+		}
+	}
+	processFn(root)
+	return entries
+}
+
+func (o *SerializeOptions) formatText(text string) string {
+	if o.CollapseWhitespace {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	if o.MaxTextLength > 0 && utf8.RuneCountInString(text) > o.MaxTextLength {
+		text = string([]rune(text)[:o.MaxTextLength]) + "..."
+	}
+	return text
+}
+
+// keep the leading items within the budget, the omitted ones are replaced by the marker
+func (o *SerializeOptions) applyBudget(items []string, sep string, marker func(omitted int) string) []string {
+	if o.MaxChars <= 0 {
+		return items
+	}
+	sepLen := utf8.RuneCountInString(sep)
+	total := 0
+	for i, item := range items {
+		if i > 0 {
+			total += sepLen
+		}
+		total += utf8.RuneCountInString(item)
+		if total <= o.MaxChars {
+			continue
+		}
+		// drop items until the marker fits as well
+		kept := i
+		size := total - utf8.RuneCountInString(item) - sepLen
+		for kept > 0 && size+sepLen+utf8.RuneCountInString(marker(len(items)-kept)) > o.MaxChars {
+			kept--
+			size -= utf8.RuneCountInString(items[kept])
+			if kept > 0 {
+				size -= sepLen
+			}
+		}
+		ret := make([]string, 0, kept+1)
+		ret = append(ret, items[:kept]...)
+		return append(ret, marker(len(items)-kept))
+	}
+	return items
+}
+
+// [index]<tag {attribute values}>text/>, elements new since the previous state are prefixed with *
+type CompactSerializer struct {
+	SerializeOptions
+}
+
+func (s *CompactSerializer) Serialize(root *DomElementNode) (string, error) {
+	lines := make([]string, 0)
+	for _, entry := range s.entries(root) {
+		if entry.node == nil {
+			lines = append(lines, entry.text)
+			continue
+		}
+		line := fmt.Sprintf("[%d]<%s ", *entry.node.HighlightIndex, entry.node.TagName)
+		if entry.node.IsNew {
+			line = "*" + line
+		}
+		attributes := make([]string, 0, len(entry.attributes))
+		for _, attribute := range entry.attributes {
+			attributes = append(attributes, attribute[1])
+		}
+		attributesStr := strings.Join(attributes, ";")
+		if attributesStr != "" {
+			line += fmt.Sprintf("{%s}", attributesStr)
+		}
+		if entry.text != "" {
+			if attributesStr != "" {
+				line += fmt.Sprintf(">%s", entry.text)
+			} else {
+				line += entry.text
+			}
+		}
+		line += "/>"
+		lines = append(lines, line)
+	}
+	lines = s.applyBudget(lines, "\n", func(omitted int) string {
+		return fmt.Sprintf("... %d more lines truncated", omitted)
+	})
+	return strings.Join(lines, "\n"), nil
+}
+
+// a json array, elements have index, tag, attributes and text, context text has only text.
+// omitted entries are counted by a last {"truncated": n} entry
+type JsonSerializer struct {
+	SerializeOptions
+}
+
+type jsonEntry struct {
+	Index      *int              `json:"index,omitempty"`
+	Tag        string            `json:"tag,omitempty"`
+	New        bool              `json:"new,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Text       string            `json:"text,omitempty"`
+}
+
+func (s *JsonSerializer) Serialize(root *DomElementNode) (string, error) {
+	items := make([]string, 0)
+	for _, entry := range s.entries(root) {
+		item := &jsonEntry{Text: entry.text}
+		if entry.node != nil {
+			item.Index = entry.node.HighlightIndex
+			item.Tag = entry.node.TagName
+			item.New = entry.node.IsNew
+			if len(entry.attributes) > 0 {
+				item.Attributes = make(map[string]string)
+				for _, attribute := range entry.attributes {
+					item.Attributes[attribute[0]] = attribute[1]
+				}
+			}
+		}
+		buf := new(strings.Builder)
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(item); err != nil {
+			return "", fmt.Errorf("encode the %s element: %w", item.Tag, err)
+		}
+		items = append(items, strings.TrimSuffix(buf.String(), "\n"))
+	}
+	items = s.applyBudget(items, ",\n", func(omitted int) string {
+		return fmt.Sprintf(`{"truncated":%d}`, omitted)
+	})
+	return "[" + strings.Join(items, ",\n") + "]", nil
+}
+
+// html like markup, <button index="3" type="submit">Send</button>,
+// elements new since the previous state carry the new attribute
+type HtmlSerializer struct {
+	SerializeOptions
+}
+
+func (s *HtmlSerializer) Serialize(root *DomElementNode) (string, error) {
+	lines := make([]string, 0)
+	for _, entry := range s.entries(root) {
+		if entry.node == nil {
+			lines = append(lines, html.EscapeString(entry.text))
+			continue
+		}
+		line := fmt.Sprintf(`<%s index="%d"`, entry.node.TagName, *entry.node.HighlightIndex)
+		if entry.node.IsNew {
+			line += " new"
+		}
+		for _, attribute := range entry.attributes {
+			line += fmt.Sprintf(` %s="%s"`, attribute[0], html.EscapeString(attribute[1]))
+		}
+		if entry.text == "" {
+			line += " />"
+		} else {
+			line += fmt.Sprintf(">%s</%s>", html.EscapeString(entry.text), entry.node.TagName)
+		}
+		lines = append(lines, line)
+	}
+	lines = s.applyBudget(lines, "\n", func(omitted int) string {
+		return fmt.Sprintf("<!-- %d more lines truncated -->", omitted)
+	})
+	return strings.Join(lines, "\n"), nil
+}
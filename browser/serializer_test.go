@@ -0,0 +1,119 @@
+package browser
+
+import (
+	"strings"
+	"testing"
+)
+
+// a form with a heading, a submit button, a new help link and an input
+func newSerializerTree() *DomElementNode {
+	body := &DomElementNode{TagName: "body"}
+	add := func(parent *DomElementNode, child DomNodeI) {
+		switch c := child.(type) {
+		case *DomElementNode:
+			c.Parent = parent
+		case *DomTextNode:
+			c.Parent = parent
+		}
+		parent.Childrens = append(parent.Childrens, child)
+	}
+	element := func(index int, tag string, attributes map[string]string, text string) *DomElementNode {
+		e := &DomElementNode{TagName: tag, Attributes: attributes, HighlightIndex: &index}
+		if text != "" {
+			add(e, &DomTextNode{Text: text, DomNode: DomNode{IsVisvable: true}})
+		}
+		return e
+	}
+	heading := &DomElementNode{TagName: "h1"}
+	add(heading, &DomTextNode{Text: "Sign <in>", DomNode: DomNode{IsVisvable: true}})
+	add(body, heading)
+	add(body, element(0, "button", map[string]string{"type": "submit", "class": "btn"}, "Send"))
+	help := element(1, "a", map[string]string{"title": "Help & support"}, "help   me\nnow")
+	help.IsNew = true
+	add(body, help)
+	add(body, element(2, "input", map[string]string{"type": "text", "placeholder": "Email"}, ""))
+	add(body, &DomTextNode{Text: "hidden", DomNode: DomNode{IsVisvable: false}})
+	return body
+}
+
+func mustSerialize(t *testing.T, s DomSerializer, root *DomElementNode) string {
+	t.Helper()
+	out, err := s.Serialize(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSerializeFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{DomFormatCompact, "Sign <in>\n" +
+			"[0]<button {submit}>Send/>\n" +
+			"*[1]<a {Help & support}>help   me\nnow/>\n" +
+			"[2]<input {text;Email}/>"},
+		{DomFormatJson, `[{"text":"Sign <in>"},` + "\n" +
+			`{"index":0,"tag":"button","attributes":{"type":"submit"},"text":"Send"},` + "\n" +
+			`{"index":1,"tag":"a","new":true,"attributes":{"title":"Help & support"},"text":"help   me\nnow"},` + "\n" +
+			`{"index":2,"tag":"input","attributes":{"placeholder":"Email","type":"text"}}]`},
+		{DomFormatHtml, "Sign &lt;in&gt;\n" +
+			`<button index="0" type="submit">Send</button>` + "\n" +
+			`<a index="1" new title="Help &amp; support">help   me` + "\nnow</a>\n" +
+			`<input index="2" type="text" placeholder="Email" />`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			s, err := NewDomSerializer(tt.format, DefaultSerializeOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mustSerialize(t, s, newSerializerTree()); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+	if _, err := NewDomSerializer("yaml", DefaultSerializeOptions()); err == nil {
+		t.Error("an unknown format is accepted")
+	}
+}
+
+func TestSerializeOptions(t *testing.T) {
+	options := SerializeOptions{IncludeAttributes: []string{"placeholder", "title"}, MaxTextLength: 6, CollapseWhitespace: true}
+	s, _ := NewDomSerializer(DomFormatCompact, options)
+	want := "Sign <...\n" +
+		"[0]<button Send/>\n" +
+		"*[1]<a {Help &...}>help m.../>\n" +
+		"[2]<input {Email}/>"
+	if got := mustSerialize(t, s, newSerializerTree()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSerializeBudget(t *testing.T) {
+	tests := []struct {
+		format   string
+		maxChars int
+		want     string
+	}{
+		{DomFormatCompact, 1000, "[2]<input {text;Email}/>"},
+		{DomFormatCompact, 63, "Sign <in>\n[0]<button {submit}>Send/>\n... 2 more lines truncated"},
+		{DomFormatCompact, 62, "Sign <in>\n... 3 more lines truncated"},
+		{DomFormatJson, 60, `[{"text":"Sign <in>"},` + "\n" + `{"truncated":3}]`},
+		{DomFormatHtml, 50, "Sign &lt;in&gt;\n<!-- 3 more lines truncated -->"},
+	}
+	for _, tt := range tests {
+		options := DefaultSerializeOptions()
+		options.MaxChars = tt.maxChars
+		s, _ := NewDomSerializer(tt.format, options)
+		got := mustSerialize(t, s, newSerializerTree())
+		if !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%s within %d chars:\n%s\nwant the end\n%s", tt.format, tt.maxChars, got, tt.want)
+		}
+		// the brackets of json are outside the budget
+		if n := len([]rune(strings.TrimSuffix(strings.TrimPrefix(got, "["), "]"))); n > tt.maxChars {
+			t.Errorf("%s output of %d chars over the budget of %d", tt.format, n, tt.maxChars)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/domsnapshot"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// DOMSnapshot.captureSnapshot evaluated in go, the page is not touched
+const DomBackendSnapshot = "snapshot"
+
+// computed styles requested from the snapshot, in this order
+var snapshotStyles = []string{"display", "visibility", "opacity", "cursor"}
+
+// same sets as isInteractiveElement of buildDomTree.js
+var snapshotInteractiveTags = map[string]bool{
+	"a": true, "button": true, "details": true, "embed": true, "input": true, "menu": true, "menuitem": true,
+	"object": true, "select": true, "textarea": true, "canvas": true, "summary": true, "dialog": true, "banner": true,
+}
+
+var snapshotInteractiveRoles = map[string]bool{
+	"button-icon": true, "dialog": true, "button-text-icon-only": true, "treeitem": true, "alert": true, "grid": true,
+	"progressbar": true, "radio": true, "checkbox": true, "menuitem": true, "option": true, "switch": true,
+	"dropdown": true, "scrollbar": true, "combobox": true, "a-button-text": true, "button": true, "region": true,
+	"textbox": true, "tabpanel": true, "tab": true, "click": true, "button-text": true, "spinbutton": true,
+	"a-button-inner": true, "link": true, "menu": true, "slider": true, "listbox": true, "a-dropdown-button": true,
+	"button-icon-only": true, "searchbox": true, "menuitemradio": true, "tooltip": true, "tree": true,
+	"menuitemcheckbox": true,
+}
+
+// content of these elements is never shown
+var snapshotSkippedTags = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+}
+
+// the documents of one target's snapshot
+type domSnapshot struct {
+	documents []*domsnapshot.DocumentSnapshot
+	strings   []string
+	viewports []ViewportInfo // viewport of every document
+}
+
+func (s *domSnapshot) str(i domsnapshot.StringIndex) string {
+	if i < 0 || int(i) >= len(s.strings) {
+		return ""
+	}
+	return s.strings[i]
+}
+
+func (s *domSnapshot) document(frameId string) *domsnapshot.DocumentSnapshot {
+	for _, doc := range s.documents {
+		if s.str(doc.FrameID) == frameId {
+			return doc
+		}
+	}
+	return nil
+}
+
+func captureDomSnapshot(ctx context.Context) (*domSnapshot, error) {
+	s := new(domSnapshot)
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		s.documents, s.strings, err = domsnapshot.CaptureSnapshot(snapshotStyles).Do(ctx)
+		if err != nil {
+			return err
+		}
+		_, _, _, _, viewport, _, err := page.GetLayoutMetrics().Do(ctx)
+		if err != nil {
+			return err
+		}
+		// the target's document has the layout viewport, frames have the size of their iframe element
+		s.viewports = make([]ViewportInfo, len(s.documents))
+		for i, doc := range s.documents {
+			s.viewports[i].ScrollX = int(doc.ScrollOffsetX)
+			s.viewports[i].ScrollY = int(doc.ScrollOffsetY)
+		}
+		if len(s.viewports) > 0 {
+			s.viewports[0].Width = int(viewport.ClientWidth)
+			s.viewports[0].Height = int(viewport.ClientHeight)
+		}
+		for _, doc := range s.documents {
+			contentDocs := doc.Nodes.ContentDocumentIndex
+			if contentDocs == nil {
+				continue
+			}
+			layoutIndex := snapshotLayoutIndex(doc)
+			for i, nodeIndex := range contentDocs.Index {
+				childDoc := int(contentDocs.Value[i])
+				l, ok := layoutIndex[nodeIndex]
+				if !ok || childDoc >= len(s.viewports) {
+					continue
+				}
+				bounds := doc.Layout.Bounds[l]
+				s.viewports[childDoc].Width = int(bounds[2])
+				s.viewports[childDoc].Height = int(bounds[3])
+			}
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// node index to layout index
+func snapshotLayoutIndex(doc *domsnapshot.DocumentSnapshot) map[int64]int {
+	layoutIndex := make(map[int64]int, len(doc.Layout.NodeIndex))
+	for l, nodeIndex := range doc.Layout.NodeIndex {
+		layoutIndex[nodeIndex] = l
+	}
+	return layoutIndex
+}
+
+func rareBooleans(data *domsnapshot.RareBooleanData) map[int64]bool {
+	ret := make(map[int64]bool)
+	if data == nil {
+		return ret
+	}
+	for _, i := range data.Index {
+		ret[i] = true
+	}
+	return ret
+}
+
+// build the tree of one frame from the snapshot of its target, interactive visible elements
+// in the viewport get indices from highlightIndexStart. the root is the body like buildDomTree.js
+func (d *DomService) buildSnapshotTree(frame *frameContext, highlightIndexStart int, s *domSnapshot) (*DomElementNode, SelectorMap, error) {
+	doc := s.document(frame.FrameId)
+	if doc == nil {
+		return nil, nil, fmt.Errorf("frame %s is not in the snapshot", frame.FrameId)
+	}
+	viewport := s.viewports[0]
+	for i, other := range s.documents {
+		if other == doc {
+			viewport = s.viewports[i]
+		}
+	}
+	nodes := doc.Nodes
+	layoutIndex := snapshotLayoutIndex(doc)
+	clickable := rareBooleans(nodes.IsClickable)
+	contentDocs := make(map[int64]int)
+	if nodes.ContentDocumentIndex != nil {
+		for i, nodeIndex := range nodes.ContentDocumentIndex.Index {
+			contentDocs[nodeIndex] = int(nodes.ContentDocumentIndex.Value[i])
+		}
+	}
+	style := func(l int, name string) string {
+		for i, n := range snapshotStyles {
+			if n == name && i < len(doc.Layout.Styles[l]) {
+				return s.str(domsnapshot.StringIndex(doc.Layout.Styles[l][i]))
+			}
+		}
+		return ""
+	}
+
+	selectorMap := make(SelectorMap)
+	highlightIndex := highlightIndexStart
+	elements := make(map[int64]*DomElementNode, len(nodes.ParentIndex))
+	xpaths := make(map[int64]string, len(nodes.ParentIndex))
+	siblingCounts := make(map[int64]map[string]int)
+	skipped := make(map[int64]bool)
+	cursors := make(map[int64]string)
+	var rootNode *DomElementNode
+	// nodes come in document order, parents before their children
+	for i := range nodes.ParentIndex {
+		idx := int64(i)
+		parentIdx := nodes.ParentIndex[i]
+		if skipped[parentIdx] {
+			skipped[idx] = true
+			continue
+		}
+		// nearest element ancestor, shadow roots and documents in between are passed
+		var parent *DomElementNode
+		for p := parentIdx; p >= 0 && parent == nil; p = nodes.ParentIndex[p] {
+			parent = elements[p]
+		}
+		nodeType := nodes.NodeType[i]
+		switch nodeType {
+		case int64(cdp.NodeTypeText):
+			if parent == nil || rootNode == nil {
+				continue
+			}
+			text := strings.TrimSpace(s.str(nodes.NodeValue[i]))
+			if text == "" {
+				continue
+			}
+			tNode := &DomTextNode{Text: text}
+			_, tNode.IsVisvable = layoutIndex[idx]
+			tNode.SetParent(parent)
+			parent.Childrens = append(parent.Childrens, tNode)
+		case int64(cdp.NodeTypeElement):
+			tagName := strings.ToLower(s.str(nodes.NodeName[i]))
+			if snapshotSkippedTags[tagName] {
+				skipped[idx] = true
+				continue
+			}
+			// xpath restarts below shadow roots and documents, like getXPathTree
+			xpath := ""
+			if parentIdx >= 0 && nodes.NodeType[parentIdx] == int64(cdp.NodeTypeElement) {
+				counts := siblingCounts[parentIdx]
+				if counts == nil {
+					counts = make(map[string]int)
+					siblingCounts[parentIdx] = counts
+				}
+				counts[tagName]++
+				xpath = xpaths[parentIdx]
+				if xpath != "" {
+					xpath += "/"
+				}
+				xpath += tagName
+				if counts[tagName] > 1 {
+					xpath += fmt.Sprintf("[%d]", counts[tagName])
+				}
+			} else {
+				xpath = tagName
+			}
+			xpaths[idx] = xpath
+			if rootNode == nil && tagName != "body" {
+				// above the body, only the path is needed
+				continue
+			}
+			element := &DomElementNode{
+				TagName:       tagName,
+				XPath:         xpath,
+				Attributes:    make(map[string]string),
+				FrameId:       frame.FrameId,
+				BackendNodeId: int(nodes.BackendNodeID[i]),
+				ViewportInfo:  viewport,
+			}
+			if i < len(nodes.Attributes) {
+				attributes := nodes.Attributes[i]
+				for a := 0; a+1 < len(attributes); a += 2 {
+					element.Attributes[s.str(domsnapshot.StringIndex(attributes[a]))] = s.str(domsnapshot.StringIndex(attributes[a+1]))
+				}
+			}
+			if childDoc, ok := contentDocs[idx]; ok && childDoc < len(s.documents) {
+				// link the frame tree below, as stampFrameOwner does for the script backend
+				element.Attributes[frameIdAttribute] = s.str(s.documents[childDoc].FrameID)
+			}
+			if l, ok := layoutIndex[idx]; ok {
+				bounds := doc.Layout.Bounds[l]
+				element.IsVisvable = bounds[2] > 0 && bounds[3] > 0 &&
+					style(l, "display") != "none" && style(l, "visibility") != "hidden" && style(l, "opacity") != "0"
+				element.PageCoordinates = snapshotCoordinates(bounds, 0, 0)
+				element.ViewportCoordinates = snapshotCoordinates(bounds, viewport.ScrollX, viewport.ScrollY)
+				vc := element.ViewportCoordinates
+				element.IsInViewPoint = vc.BottomRight.X > 0 && vc.BottomRight.Y > 0 &&
+					vc.TopLeft.X < viewport.Width && vc.TopLeft.Y < viewport.Height
+				// occlusion is not checked, the top element test of the script needs elementFromPoint
+				element.IsTopElement = element.IsVisvable
+				// the pointer cursor is inherited, only the element setting it counts
+				cursors[idx] = style(l, "cursor")
+				pointer := cursors[idx] == "pointer" && cursors[parentIdx] != "pointer"
+				element.IsInteractive = snapshotInteractive(element, clickable[idx], pointer)
+			}
+			if element.IsInteractive && element.IsVisvable && element.IsInViewPoint {
+				index := highlightIndex
+				highlightIndex++
+				element.HighlightIndex = &index
+				selectorMap[index] = element
+			}
+			elements[idx] = element
+			if rootNode == nil {
+				rootNode = element
+				continue
+			}
+			if parent != nil {
+				element.SetParent(parent)
+				parent.Childrens = append(parent.Childrens, element)
+			}
+		}
+	}
+	// out of process frames are not in this snapshot, link them by their owner elements
+	for _, child := range d.frames {
+		if child.ParentId != frame.FrameId || !child.IsOOPIF {
+			continue
+		}
+		_ = chromedp.Run(frame.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+			owner, _, err := dom.GetFrameOwner(cdp.FrameID(child.FrameId)).Do(ctx)
+			if err != nil {
+				return err
+			}
+			for _, element := range elements {
+				if element.BackendNodeId == int(owner) {
+					element.Attributes[frameIdAttribute] = child.FrameId
+				}
+			}
+			return nil
+		}))
+	}
+	return rootNode, selectorMap, nil
+}
+
+func snapshotCoordinates(bounds domsnapshot.Rectangle, scrollX int, scrollY int) CoordinateSet {
+	x := int(math.Round(bounds[0])) - scrollX
+	y := int(math.Round(bounds[1])) - scrollY
+	width := int(math.Round(bounds[2]))
+	height := int(math.Round(bounds[3]))
+	return CoordinateSet{
+		TopLeft:     Coordinates{X: x, Y: y},
+		TopRight:    Coordinates{X: x + width, Y: y},
+		BottomLeft:  Coordinates{X: x, Y: y + height},
+		BottomRight: Coordinates{X: x + width, Y: y + height},
+		Center:      Coordinates{X: x + width/2, Y: y + height/2},
+		Width:       width,
+		Height:      height,
+	}
+}
+
+// the checks of isInteractiveElement that do not need the page
+func snapshotInteractive(element *DomElementNode, clickable bool, pointer bool) bool {
+	attributes := element.Attributes
+	if _, ok := attributes["disabled"]; ok {
+		return false
+	}
+	if snapshotInteractiveTags[element.TagName] ||
+		snapshotInteractiveRoles[attributes["role"]] ||
+		snapshotInteractiveRoles[attributes["aria-role"]] {
+		return true
+	}
+	if tabIndex, ok := attributes["tabindex"]; ok && tabIndex != "-1" {
+		return true
+	}
+	if attributes["aria-haspopup"] == "true" || attributes["data-toggle"] == "dropdown" {
+		return true
+	}
+	if editable, ok := attributes["contenteditable"]; ok && editable != "false" {
+		return true
+	}
+	// click listeners and pointer cursors
+	return clickable || pointer
+}
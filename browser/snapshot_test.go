@@ -0,0 +1,71 @@
+package browser
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// a page with a few hundred elements, a third of them interactive
+func benchmarkPage() string {
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, `<div class="row"><p>row %d text</p>`, i)
+		fmt.Fprintf(&sb, `<a href="#%d">link %d</a><button type="button">button %d</button>`, i, i, i)
+		fmt.Fprintf(&sb, `<input name="field%d" placeholder="field %d"></div>`, i, i)
+	}
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// chromedp looks for these names
+func chromeInstalled() bool {
+	for _, name := range []string{"headless_shell", "headless-shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func benchmarkBackend(b *testing.B, backend string) {
+	if !chromeInstalled() {
+		b.Skip("chrome is not installed")
+	}
+	content := benchmarkPage()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	config := DefaultBrowserConfig()
+	config.DomBackend = backend
+	br := NewBrowserWithConfig(config)
+	defer br.Close()
+	if err := br.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		state, err := br.DomService.GetClickableElements()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(state.SelectorMap) == 0 {
+			b.Fatal("no interactive elements found")
+		}
+	}
+}
+
+func BenchmarkScriptBackend(b *testing.B) {
+	benchmarkBackend(b, DomBackendScript)
+}
+
+func BenchmarkSnapshotBackend(b *testing.B) {
+	benchmarkBackend(b, DomBackendSnapshot)
+}
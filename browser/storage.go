@@ -0,0 +1,249 @@
+package browser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+)
+
+// storage state file, compatible with playwright's storageState.
+// sessionStorage is an extension playwright ignores when loading.
+type StorageState struct {
+	Cookies []*StorageCookie `json:"cookies"`
+	Origins []*OriginStorage `json:"origins"`
+}
+
+type StorageCookie struct {
+	Name     string  `json:"name"`
+	Value    string  `json:"value"`
+	Domain   string  `json:"domain"`
+	Path     string  `json:"path"`
+	Expires  float64 `json:"expires"` // unix seconds, -1 for session cookies
+	HTTPOnly bool    `json:"httpOnly"`
+	Secure   bool    `json:"secure"`
+	SameSite string  `json:"sameSite"` // Strict, Lax or None
+}
+
+type OriginStorage struct {
+	Origin         string         `json:"origin"`
+	LocalStorage   []*StorageItem `json:"localStorage"`
+	SessionStorage []*StorageItem `json:"sessionStorage,omitempty"`
+}
+
+type StorageItem struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+var readStorageJs = `(() => {
+  const items = (storage) => {
+    try {
+      return Object.keys(storage).map(name => ({ name, value: storage.getItem(name) }));
+    } catch (e) {
+      return [];
+    }
+  };
+  return { origin: location.origin, localStorage: items(localStorage), sessionStorage: items(sessionStorage) };
+})()`
+
+// write the items given as arguments into the storages of the current origin
+var writeStorageJs = `((localItems, sessionItems) => {
+  for (const { name, value } of localItems) localStorage.setItem(name, value);
+  for (const { name, value } of sessionItems) sessionStorage.setItem(name, value);
+})`
+
+// blank document served for an origin while its storage is written
+var blankDocument = "<html><head></head><body></body></html>"
+
+// save cookies of all domains and the web storage of every origin open in a tab
+func (b *Browser) SaveStorageState(path string) error {
+	state, err := b.GetStorageState()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (b *Browser) GetStorageState() (*StorageState, error) {
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return nil, err
+	}
+	state := &StorageState{
+		Cookies: make([]*StorageCookie, 0),
+		Origins: make([]*OriginStorage, 0),
+	}
+	var cookies []*network.Cookie
+	if err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		cookies, err = storage.GetCookies().Do(ctx)
+		return err
+	})); err != nil {
+		return nil, err
+	}
+	for _, c := range cookies {
+		sameSite := string(c.SameSite)
+		if sameSite == "" {
+			sameSite = string(network.CookieSameSiteLax)
+		}
+		expires := c.Expires
+		if c.Session {
+			expires = -1
+		}
+		state.Cookies = append(state.Cookies, &StorageCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  expires,
+			HTTPOnly: c.HTTPOnly,
+			Secure:   c.Secure,
+			SameSite: sameSite,
+		})
+	}
+	origins := make(map[string]*OriginStorage)
+	for _, tab := range b.tabs {
+		frames, err := b.collectTargetFrames(tab, false)
+		if err != nil {
+			continue
+		}
+		for _, frame := range frames {
+			out, err := frame.evaluate(readStorageJs)
+			if err != nil {
+				continue
+			}
+			origin := new(OriginStorage)
+			if err := json.Unmarshal(out, origin); err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(origin.Origin, "http") || origins[origin.Origin] != nil {
+				// opaque origins and about:blank have no persistent storage
+				continue
+			}
+			if len(origin.LocalStorage) == 0 && len(origin.SessionStorage) == 0 {
+				continue
+			}
+			origins[origin.Origin] = origin
+			state.Origins = append(state.Origins, origin)
+		}
+	}
+	return state, nil
+}
+
+// load a storage state file saved by SaveStorageState or playwright
+func (b *Browser) LoadStorageState(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	state := new(StorageState)
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("invalid storage state %s: %w", path, err)
+	}
+	return b.SetStorageState(state)
+}
+
+func (b *Browser) SetStorageState(state *StorageState) (err error) {
+	ctx, err := b.getCurrentPage()
+	if err != nil {
+		return err
+	}
+	cookies := make([]*network.CookieParam, 0, len(state.Cookies))
+	for _, c := range state.Cookies {
+		param := &network.CookieParam{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+			SameSite: network.CookieSameSite(c.SameSite),
+		}
+		if c.Expires > 0 {
+			sec, frac := math.Modf(c.Expires)
+			expires := cdp.TimeSinceEpoch(time.Unix(int64(sec), int64(frac*1e9)))
+			param.Expires = &expires
+		}
+		cookies = append(cookies, param)
+	}
+	if len(cookies) > 0 {
+		if err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+			return storage.SetCookies(cookies).Do(ctx)
+		})); err != nil {
+			return err
+		}
+	}
+	resume, err := b.suspendInterception(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if resumeErr := resume(); resumeErr != nil && err == nil {
+			err = resumeErr
+		}
+	}()
+	for _, origin := range state.Origins {
+		if err := b.setOriginStorage(ctx, origin); err != nil {
+			return fmt.Errorf("set storage of %s: %w", origin.Origin, err)
+		}
+	}
+	if len(state.Origins) > 0 {
+		return chromedp.Run(ctx, chromedp.Navigate("about:blank"))
+	}
+	return nil
+}
+
+// web storage can only be written from a document of the origin,
+// so navigate the tab to the origin with a blank document served by the interceptor
+func (b *Browser) setOriginStorage(ctx context.Context, origin *OriginStorage) error {
+	lctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chromedp.ListenTarget(lctx, func(ev any) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		go func() {
+			c := chromedp.FromContext(ctx)
+			_ = fetch.FulfillRequest(paused.RequestID, 200).
+				WithResponseHeaders([]*fetch.HeaderEntry{{Name: "Content-Type", Value: "text/html"}}).
+				WithBody(base64.StdEncoding.EncodeToString([]byte(blankDocument))).
+				Do(cdp.WithExecutor(ctx, c.Target))
+		}()
+	})
+	localItems := origin.LocalStorage
+	if localItems == nil {
+		localItems = make([]*StorageItem, 0)
+	}
+	sessionItems := origin.SessionStorage
+	if sessionItems == nil {
+		sessionItems = make([]*StorageItem, 0)
+	}
+	localData, _ := json.Marshal(localItems)
+	sessionData, _ := json.Marshal(sessionItems)
+	tasks := chromedp.Tasks{
+		fetch.Enable().WithPatterns([]*fetch.RequestPattern{{
+			URLPattern:   origin.Origin + "/*",
+			ResourceType: network.ResourceTypeDocument,
+		}}),
+		chromedp.Navigate(origin.Origin + "/"),
+		chromedp.Evaluate(fmt.Sprintf("(%s)(%s, %s)", writeStorageJs, localData, sessionData), nil),
+		fetch.Disable(),
+	}
+	return chromedp.Run(ctx, tasks...)
+}
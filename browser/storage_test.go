@@ -0,0 +1,80 @@
+package browser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorageState(t *testing.T) {
+	if !chromeInstalled() {
+		t.Skip("chrome is not installed")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(`<html><body>storage</body></html>`))
+	}))
+	defer server.Close()
+	// chrome caps the expiry at 400 days
+	expires := float64(time.Now().Add(30*24*time.Hour).Unix()) + 0.5
+	state := &StorageState{
+		Cookies: []*StorageCookie{
+			{Name: "session", Value: "s1", Domain: "127.0.0.1", Path: "/", Expires: -1, SameSite: "Lax"},
+			{Name: "remember", Value: "r1", Domain: "127.0.0.1", Path: "/", Expires: expires, HTTPOnly: true, SameSite: "Strict"},
+		},
+		Origins: []*OriginStorage{{
+			Origin:         server.URL,
+			LocalStorage:   []*StorageItem{{Name: "theme", Value: "dark"}},
+			SessionStorage: []*StorageItem{{Name: "step", Value: "2"}},
+		}},
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	b := NewBrowser()
+	defer b.Close()
+	if err := b.SetStorageState(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveStorageState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewBrowser()
+	defer loaded.Close()
+	if err := loaded.LoadStorageState(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.GoToUrlInCurrentTab(&GoToUrlInCurrentTabParam{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loaded.GetStorageState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := make(map[string]*StorageCookie)
+	for _, c := range got.Cookies {
+		cookies[c.Name] = c
+	}
+	if c := cookies["session"]; c == nil || c.Value != "s1" || c.Expires != -1 || c.SameSite != "Lax" {
+		t.Errorf("session cookie %+v", c)
+	}
+	if c := cookies["remember"]; c == nil || c.Value != "r1" || !c.HTTPOnly || c.SameSite != "Strict" || int64(c.Expires) != int64(expires) {
+		t.Errorf("remember cookie %+v", c)
+	}
+	if len(got.Origins) != 1 || got.Origins[0].Origin != server.URL {
+		t.Fatalf("origins %+v", got.Origins)
+	}
+	local := got.Origins[0].LocalStorage
+	if len(local) != 1 || local[0].Name != "theme" || local[0].Value != "dark" {
+		t.Errorf("local storage %+v", local)
+	}
+	session := got.Origins[0].SessionStorage
+	if len(session) != 1 || session[0].Name != "step" || session[0].Value != "2" {
+		t.Errorf("session storage %+v", session)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/agent"
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+	"lizhanpeng.org/lizhanpeng/agent/script"
+	"lizhanpeng.org/lizhanpeng/agent/server"
+)
+
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	bf := addBrowserFlags(fs)
+	model := fs.String("model", env("AGENT_MODEL", "gpt-4o"), "chat model [AGENT_MODEL]")
+	baseUrl := fs.String("base-url", env("AGENT_BASE_URL", "https://api.openai.com/v1"), "openai compatible api [AGENT_BASE_URL]")
+	// the key is read from the environment after parsing, so -h does not print it
+	apiKey := fs.String("api-key", "", "api key [AGENT_API_KEY or OPENAI_API_KEY]")
+	maxSteps := fs.Int("max-steps", envInt("AGENT_MAX_STEPS", 50), "steps before the run gives up [AGENT_MAX_STEPS]")
+	historyPath := fs.String("history", "", "write the run history as json to this file")
+	gifPath := fs.String("gif", "", "write the run as an animated gif to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agent run [flags] <task>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	task := strings.Join(fs.Args(), " ")
+	if task == "" {
+		return &usageError{errors.New("no task given")}
+	}
+	if *apiKey == "" {
+		*apiKey = env("AGENT_API_KEY", os.Getenv("OPENAI_API_KEY"))
+	}
+	if *apiKey == "" {
+		return &usageError{errors.New("no api key, set -api-key or AGENT_API_KEY")}
+	}
+	config, err := bf.config()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	b := browser.NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.Start(); err != nil {
+		return err
+	}
+	a := agent.NewAgent(task, b, nil)
+	history, runErr := a.Run(ctx, controller.NewOpenAIChat(*baseUrl, *apiKey, *model), *maxSteps)
+	if *historyPath != "" {
+		if err := history.SaveToFile(*historyPath); err != nil {
+			return err
+		}
+	}
+	if *gifPath != "" {
+		if err := history.SaveGif(*gifPath, agent.DefaultGifOptions()); err != nil {
+			return err
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+	last := history.History[len(history.History)-1].Results
+	done := last[len(last)-1]
+	fmt.Println(done.ExtractedContent)
+	if !done.Success {
+		return errors.New("the task is not completed")
+	}
+	return nil
+}
+
+func domCommand(args []string) error {
+	fs := flag.NewFlagSet("dom", flag.ContinueOnError)
+	bf := addBrowserFlags(fs)
+	format := fs.String("format", env("AGENT_DOM_FORMAT", browser.DomFormatCompact), "compact, json or html [AGENT_DOM_FORMAT]")
+	wait := fs.Duration("wait", time.Second, "wait after loading the page")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agent dom [flags] <url>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return &usageError{errors.New("give one url")}
+	}
+	config, err := bf.config()
+	if err != nil {
+		return err
+	}
+	serializer, err := browser.NewDomSerializer(*format, browser.DefaultSerializeOptions())
+	if err != nil {
+		return &usageError{err}
+	}
+	config.DomSerializer = serializer
+	b := browser.NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.Start(); err != nil {
+		return err
+	}
+	if err := b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{Url: fs.Arg(0)}); err != nil {
+		return err
+	}
+	time.Sleep(*wait)
+	if err := b.UpdateState(); err != nil {
+		return err
+	}
+	elements, err := b.SerializeElements(b.GetState())
+	if err != nil {
+		return err
+	}
+	fmt.Println(elements)
+	return nil
+}
+
+func screenshotCommand(args []string) error {
+	fs := flag.NewFlagSet("screenshot", flag.ContinueOnError)
+	bf := addBrowserFlags(fs)
+	output := fs.String("o", "screenshot.png", "file to write, .png, .jpg or .jpeg")
+	fullPage := fs.Bool("full-page", false, "capture the whole page instead of the viewport")
+	quality := fs.Int("quality", 90, "jpeg quality")
+	maxWidth := fs.Int("max-width", 0, "scale wider images down to this width")
+	annotate := fs.Bool("annotate", false, "draw the interactive elements and their indices")
+	wait := fs.Duration("wait", time.Second, "wait after loading the page")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agent screenshot [flags] <url>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return &usageError{errors.New("give one url")}
+	}
+	config, err := bf.config()
+	if err != nil {
+		return err
+	}
+	options := &browser.ScreenshotOptions{
+		FullPage: *fullPage,
+		Format:   browser.ScreenshotFormatPng,
+		Quality:  *quality,
+		MaxWidth: *maxWidth,
+	}
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".jpg", ".jpeg":
+		options.Format = browser.ScreenshotFormatJpeg
+	case ".png":
+	default:
+		return &usageError{fmt.Errorf("%s is not a .png or .jpg file", *output)}
+	}
+	config.Screenshot = options
+	config.AnnotateScreenshot = *annotate
+	b := browser.NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.Start(); err != nil {
+		return err
+	}
+	if err := b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{Url: fs.Arg(0)}); err != nil {
+		return err
+	}
+	time.Sleep(*wait)
+	var data []byte
+	if *annotate {
+		// the state screenshot has the elements drawn on it
+		if err := b.UpdateState(); err != nil {
+			return err
+		}
+		data = b.GetState().ScreentShot
+		if len(data) == 0 {
+			return errors.New("the screenshot failed, see the logs")
+		}
+	} else if data, err = b.TakeScreenshot(options); err != nil {
+		return err
+	}
+	return os.WriteFile(*output, data, 0644)
+}
+
+func scriptCommand(args []string) error {
+	fs := flag.NewFlagSet("script", flag.ContinueOnError)
+	bf := addBrowserFlags(fs)
+	var vars listFlag
+	fs.Var(&vars, "var", "name=value overriding a variable of the script, repeatable")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agent script [flags] <file.json|file.yaml>")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return &usageError{errors.New("give one script file")}
+	}
+	s, err := script.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	config, err := bf.config()
+	if err != nil {
+		return err
+	}
+	b := browser.NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.Start(); err != nil {
+		return err
+	}
+	runner := script.NewRunner(b)
+	for _, v := range vars {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return &usageError{fmt.Errorf("-var %q is not name=value", v)}
+		}
+		runner.Variables[name] = value
+	}
+	results, err := runner.Run(s)
+	for _, r := range results {
+		if r.ExtractedContent != "" {
+			fmt.Println(r.ExtractedContent)
+		}
+	}
+	return err
+}
+
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	bf := addBrowserFlags(fs)
+	addr := fs.String("addr", env("AGENT_ADDR", "localhost:8080"), "address to listen on [AGENT_ADDR]")
+	requestTimeout := fs.Duration("request-timeout", envDuration("AGENT_REQUEST_TIMEOUT", time.Minute), "longest wait for a request, 0 for no limit [AGENT_REQUEST_TIMEOUT]")
+	idleTimeout := fs.Duration("idle-timeout", envDuration("AGENT_IDLE_TIMEOUT", 10*time.Minute), "close sessions unused this long, 0 keeps them [AGENT_IDLE_TIMEOUT]")
+	maxSessions := fs.Int("max-sessions", envInt("AGENT_MAX_SESSIONS", 0), "open sessions at most, 0 for no limit [AGENT_MAX_SESSIONS]")
+	token := fs.String("token", env("AGENT_TOKEN", ""), "bearer token the requests need, empty for none [AGENT_TOKEN]")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agent serve [flags]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return &usageError{errors.New("serve takes no arguments")}
+	}
+	config, err := bf.config()
+	if err != nil {
+		return err
+	}
+	s := server.New(&server.Options{
+		Config:         config,
+		RequestTimeout: *requestTimeout,
+		IdleTimeout:    *idleTimeout,
+		MaxSessions:    *maxSessions,
+		Token:          *token,
+		Logger:         config.Logger,
+	})
+	defer s.Close()
+	httpServer := &http.Server{Addr: *addr, Handler: s.Handler()}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdown)
+	}()
+	if *token == "" && !isLoopback(*addr) {
+		fmt.Fprintln(os.Stderr, "warning: anyone reaching", *addr, "can drive the browser, set -token")
+	}
+	fmt.Fprintln(os.Stderr, "listening on", *addr)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// the address listens only on the loopback interface, an empty host listens on every interface
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
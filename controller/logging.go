@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// drops every record, the default of all loggers
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+func DiscardLogger() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// logger of action records when the caller has none
+var defaultLogger = DiscardLogger()
+
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = DiscardLogger()
+	}
+	defaultLogger = l
+}
+
+// emit one record for an executed action, the params are logged as json with the secrets redacted.
+// attrs add context like the tab and url
+func LogAction(l *slog.Logger, action string, params any, sensitiveData SensitiveData, duration time.Duration, err error, attrs ...any) {
+	if l == nil {
+		l = defaultLogger
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+	}
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	args := append([]any{
+		slog.String("action", action),
+		slog.String("params", RedactParams(params, sensitiveData)),
+		slog.Duration("duration", duration),
+	}, attrs...)
+	if err != nil {
+		args = append(args, slog.String("error", sensitiveData.Redact(err.Error())))
+	}
+	l.Log(context.Background(), level, "action", args...)
+}
+
+// params as json with every secret value replaced by its placeholder
+func RedactParams(params any, sensitiveData SensitiveData) string {
+	if params == nil {
+		return "{}"
+	}
+	data, err := marshalText(params)
+	if err != nil {
+		return "<unserializable>"
+	}
+	if len(sensitiveData) == 0 {
+		return data
+	}
+	// values with quotes or control characters are escaped in json
+	return sensitiveData.redactor(func(value string) string {
+		quoted, _ := marshalText(value)
+		return quoted[1 : len(quoted)-1]
+	}).Replace(data)
+}
+
+// json without escaping <, > and &, placeholders stay readable
+func marshalText(v any) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -1,4 +1,26 @@
 package controller
 
+type Message struct {
+	Role    string // system, user or assistant
+	Content string
+}
+
 type MessageManager struct {
+	SensitiveData SensitiveData
+	History       []*Message
+}
+
+func NewMessageManager(sensitiveData SensitiveData) *MessageManager {
+	m := new(MessageManager)
+	m.SensitiveData = sensitiveData
+	m.History = make([]*Message, 0)
+	return m
+}
+
+// add a message to the history, secret values never reach the model
+func (m *MessageManager) AddMessage(role string, content string) {
+	m.History = append(m.History, &Message{
+		Role:    role,
+		Content: m.SensitiveData.Redact(content),
+	})
 }
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// chat completions of an openai compatible api
+type OpenAIChat struct {
+	BaseUrl     string // like https://api.openai.com/v1
+	ApiKey      string
+	Model       string
+	Temperature float64
+	Client      *http.Client // http.DefaultClient when nil
+}
+
+func NewOpenAIChat(baseUrl string, apiKey string, model string) *OpenAIChat {
+	return &OpenAIChat{
+		BaseUrl: strings.TrimSuffix(baseUrl, "/"),
+		ApiKey:  apiKey,
+		Model:   model,
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string         `json:"model"`
+	Messages    []*chatMessage `json:"messages"`
+	Temperature float64        `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// the answer of the model to the messages
+func (c *OpenAIChat) Chat(ctx context.Context, messages []*Message) (string, error) {
+	req := &chatRequest{Model: c.Model, Temperature: c.Temperature}
+	for _, m := range messages {
+		req.Messages = append(req.Messages, &chatMessage{Role: m.Role, Content: m.Content})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseUrl+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.ApiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.ApiKey)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	var ret chatResponse
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return "", fmt.Errorf("chat completion: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if ret.Error != nil {
+		return "", fmt.Errorf("chat completion: %s: %s", resp.Status, ret.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("chat completion: %s", resp.Status)
+	}
+	if len(ret.Choices) == 0 {
+		return "", errors.New("chat completion: no choices")
+	}
+	return ret.Choices[0].Message.Content, nil
+}
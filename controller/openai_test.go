@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIChat(t *testing.T) {
+	var got chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, `{"error": {"message": "wrong request"}}`, http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "the answer"}}]}`))
+	}))
+	defer server.Close()
+
+	c := NewOpenAIChat(server.URL+"/v1/", "key", "test-model")
+	c.Temperature = 0.5
+	answer, err := c.Chat(context.Background(), []*Message{{Role: "system", Content: "rules"}, {Role: "user", Content: "task"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "the answer" {
+		t.Errorf("answer %q", answer)
+	}
+	if got.Model != "test-model" || got.Temperature != 0.5 || len(got.Messages) != 2 || got.Messages[1].Role != "user" || got.Messages[1].Content != "task" {
+		t.Errorf("request %+v", got)
+	}
+}
+
+func TestOpenAIChatErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"api error", http.StatusUnauthorized, `{"error": {"message": "invalid api key"}}`, "401 Unauthorized: invalid api key"},
+		{"not json", http.StatusBadGateway, "bad gateway\n", "502 Bad Gateway: bad gateway"},
+		{"status without error", http.StatusInternalServerError, `{}`, "500 Internal Server Error"},
+		{"no choices", http.StatusOK, `{"choices": []}`, "no choices"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			_, err := NewOpenAIChat(server.URL, "", "test-model").Chat(context.Background(), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewOpenAIChat("http://127.0.0.1:1", "", "test-model").Chat(ctx, nil); err == nil {
+		t.Error("a canceled chat succeeded")
+	}
+}
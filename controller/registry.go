@@ -1,22 +1,208 @@
 package controller
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runs an action, executor is what the registering package acts on, like the browser
+type ActionHandler func(executor any, params any) (*ActionResult, error)
 
 type Action struct {
 	Name        string
 	Description string
 	Params      any
+	Handler     ActionHandler
 }
 
 var actions = make(map[string]*Action)
 
-func RegistryAction(name string, description string, parmas any) {
+func RegistryAction(name string, description string, parmas any, handler ActionHandler) {
 	if actions[name] != nil {
-		panic(fmt.Sprint("%s already resgistered", name))
+		panic(fmt.Sprintf("%s already resgistered", name))
 	}
 	actions[name] = &Action{
 		Name:        name,
 		Description: description,
 		Params:      parmas,
+		Handler:     handler,
+	}
+}
+
+// the registered action, nil when there is none with the name
+func GetAction(name string) *Action {
+	return actions[name]
+}
+
+// every registered action ordered by name
+func GetActions() []*Action {
+	ret := make([]*Action, 0, len(actions))
+	for _, action := range actions {
+		ret = append(ret, action)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// a new value of the action's param type filled from params, which may be the type itself,
+// a map or json. fields the type does not have are an error. nil for actions without params
+func (a *Action) DecodeParams(params any) (any, error) {
+	if a.Params == nil {
+		return nil, nil
+	}
+	t := reflect.TypeOf(a.Params)
+	if reflect.TypeOf(params) == t {
+		return params, nil
+	}
+	var data []byte
+	switch p := params.(type) {
+	case nil:
+		data = []byte("{}")
+	case json.RawMessage:
+		data = p
+	case []byte:
+		data = p
+	default:
+		var err error
+		if data, err = json.Marshal(p); err != nil {
+			return nil, err
+		}
+	}
+	value := reflect.New(t.Elem()).Interface()
+	// a misspelled field would silently take its zero value
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil {
+		return nil, fmt.Errorf("invalid params of %s: %w", a.Name, err)
+	}
+	return value, nil
+}
+
+// the action as the model sees it, with the fields of its params and their types
+func (a *Action) Prompt() string {
+	if a.Params == nil {
+		return fmt.Sprintf("%s: %s", a.Name, a.Description)
+	}
+	fields := make([]string, 0)
+	for _, f := range a.paramFields() {
+		typ := f.Type.String()
+		if f.Type.Kind() == reflect.Pointer {
+			typ = f.Type.Elem().String() + ", optional"
+		}
+		fields = append(fields, fmt.Sprintf("%q: %s", f.Name, typ))
+	}
+	return fmt.Sprintf("%s: %s, params {%s}", a.Name, a.Description, strings.Join(fields, ", "))
+}
+
+// names of the fields of the action's params
+func (a *Action) ParamNames() []string {
+	names := make([]string, 0)
+	for _, f := range a.paramFields() {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// json schema of the params, the fields are matched case insensitively when decoding
+func (a *Action) Schema() map[string]any {
+	properties := make(map[string]any)
+	for _, f := range a.paramFields() {
+		t := f.Type
+		property := make(map[string]any)
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+			property["nullable"] = true
+		}
+		property["type"] = jsonType(t)
+		properties[f.Name] = property
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "string"
+}
+
+func (a *Action) paramFields() []reflect.StructField {
+	if a.Params == nil {
+		return nil
+	}
+	t := reflect.TypeOf(a.Params)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
 	}
+	fields := make([]reflect.StructField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// decode the params and run the action on the executor, the result is never nil without an error.
+// the dispatch is logged to logger, or to the logger of SetLogger when it is nil. params are not
+// logged here, the executors log them with their secrets redacted. errors may quote what the page
+// showed or the action typed, they are logged with the secret values of sensitiveData redacted
+func (a *Action) Execute(logger *slog.Logger, sensitiveData SensitiveData, executor any, params any) (result *ActionResult, err error) {
+	if logger == nil {
+		logger = defaultLogger
+	}
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			logger.Warn("action dispatch failed", "action", a.Name, "duration", time.Since(start), "error", sensitiveData.Redact(err.Error()))
+			return
+		}
+		logger.Debug("action dispatched", "action", a.Name, "duration", time.Since(start), "done", result.IsDone)
+	}()
+	if a.Handler == nil {
+		return nil, fmt.Errorf("action %s can not be executed", a.Name)
+	}
+	value, err := a.DecodeParams(params)
+	if err != nil {
+		return nil, err
+	}
+	result, err = a.Handler(executor, value)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		result = new(ActionResult)
+	}
+	return result, nil
+}
+
+// outcome of an action, given back to the model in the next step
+type ActionResult struct {
+	IsDone           bool
+	Success          bool     // with IsDone, whether the task was completed
+	ExtractedContent string   // what the action found or did, in words for the model
+	Error            string   // why the action failed
+	IncludeInMemory  bool     // keep ExtractedContent in the message history
+	Attachments      []string // files the action wrote
 }
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type echoParams struct {
+	Text string
+}
+
+func newEchoAction(err error) *Action {
+	return &Action{
+		Name:   "echo",
+		Params: new(echoParams),
+		Handler: func(_ any, params any) (*ActionResult, error) {
+			if err != nil {
+				return nil, err
+			}
+			return &ActionResult{ExtractedContent: params.(*echoParams).Text}, nil
+		},
+	}
+}
+
+func TestExecuteLogsDispatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		action *Action
+		params any
+		want   []string
+	}{
+		{"success", newEchoAction(nil), map[string]any{"text": "hunter2"}, []string{"level=DEBUG", "action=echo", "done=false"}},
+		{"handler error", newEchoAction(errors.New("boom")), nil, []string{"level=WARN", "action=echo", "error=boom"}},
+		{"secret in the error", newEchoAction(errors.New("hunter2 is wrong")), nil, []string{"level=WARN", "<secret>password</secret> is wrong"}},
+		{"invalid params", newEchoAction(nil), `{"text": 1}`, []string{"level=WARN", "action=echo", "invalid params of echo"}},
+		{"no handler", &Action{Name: "echo"}, nil, []string{"level=WARN", "can not be executed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			tt.action.Execute(l, SensitiveData{"password": "hunter2"}, nil, tt.params)
+			out := buf.String()
+			if strings.Count(out, "\n") != 1 {
+				t.Fatalf("want one record, got %q", out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("record misses %q: %s", want, out)
+				}
+			}
+			// params may carry secrets and are not logged on dispatch, errors are redacted
+			if strings.Contains(out, "hunter2") {
+				t.Errorf("params in record: %s", out)
+			}
+		})
+	}
+}
+
+func TestExecuteDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(nil)
+	if _, err := newEchoAction(nil).Execute(nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "action=echo") {
+		t.Errorf("dispatch is not logged to the logger of SetLogger: %q", buf.String())
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	action := newEchoAction(nil)
+	same := &echoParams{Text: "as is"}
+	tests := []struct {
+		name   string
+		params any
+		want   string
+		err    bool
+	}{
+		{"param type", same, "as is", false},
+		{"map", map[string]any{"Text": "from a map"}, "from a map", false},
+		{"lower case field", map[string]any{"text": "case insensitive"}, "case insensitive", false},
+		{"json", []byte(`{"Text": "from json"}`), "from json", false},
+		{"raw message", json.RawMessage(`{"text": "raw"}`), "raw", false},
+		{"nil", nil, "", false},
+		{"wrong type", map[string]any{"Text": 1}, "", true},
+		{"not an object", []byte(`"text"`), "", true},
+		{"unmarshalable", map[string]any{"Text": func() {}}, "", true},
+		{"unknown field", map[string]any{"Text": "hi", "Goal": "misspelled"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := action.DecodeParams(tt.params)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("decoded %+v", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := value.(*echoParams).Text; got != tt.want {
+				t.Errorf("Text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if value, _ := action.DecodeParams(same); value != same {
+		t.Error("params of the param type are copied")
+	}
+	if value, err := (&Action{Name: "go_back"}).DecodeParams(map[string]any{"ignored": 1}); value != nil || err != nil {
+		t.Errorf("action without params decoded %v, %v", value, err)
+	}
+}
+
+type promptParams struct {
+	Index  int
+	Text   string
+	Offset *int
+}
+
+func TestActionPrompt(t *testing.T) {
+	tests := []struct {
+		action *Action
+		want   string
+	}{
+		{&Action{Name: "go_back", Description: "Go back"}, "go_back: Go back"},
+		{&Action{Name: "echo", Description: "Echo the text", Params: new(echoParams)}, `echo: Echo the text, params {"Text": string}`},
+		{&Action{Name: "type", Description: "Type", Params: new(promptParams)}, `type: Type, params {"Index": int, "Text": string, "Offset": int, optional}`},
+	}
+	for _, tt := range tests {
+		if got := tt.action.Prompt(); got != tt.want {
+			t.Errorf("Prompt() = %s, want %s", got, tt.want)
+		}
+	}
+}
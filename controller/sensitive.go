@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secret names to real values, the model only sees the names as <secret>name</secret>
+type SensitiveData map[string]string
+
+var secretPattern = regexp.MustCompile(`<secret>(.*?)</secret>`)
+
+func SecretPlaceholder(name string) string {
+	return "<secret>" + name + "</secret>"
+}
+
+// replace the placeholders with the real values, unknown names are kept as is
+func (s SensitiveData) Replace(text string) string {
+	if len(s) == 0 {
+		return text
+	}
+	return secretPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := secretPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := s[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// replace every occurrence of a secret value with its placeholder
+func (s SensitiveData) Redact(text string) string {
+	if len(s) == 0 {
+		return text
+	}
+	return s.redactor(func(value string) string { return value }).Replace(text)
+}
+
+// a single pass replacer, so placeholders already written are never redacted again.
+// encode maps a value to the form it has in the text
+func (s SensitiveData) redactor(encode func(value string) string) *strings.Replacer {
+	names := make([]string, 0, len(s))
+	for name, value := range s {
+		if value == "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	// longer values first, a value containing another one must be redacted as a whole.
+	// the replacer tries the pairs in argument order
+	sort.Slice(names, func(i, j int) bool {
+		if len(s[names[i]]) != len(s[names[j]]) {
+			return len(s[names[i]]) > len(s[names[j]])
+		}
+		return names[i] < names[j]
+	})
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, encode(s[name]), SecretPlaceholder(name))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// sorted secret names the model may reference
+func (s SensitiveData) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSensitiveDataReplace(t *testing.T) {
+	tests := []struct {
+		name string
+		data SensitiveData
+		text string
+		want string
+	}{
+		{"no secrets", nil, "<secret>password</secret>", "<secret>password</secret>"},
+		{"one placeholder", SensitiveData{"password": "hunter2"}, "<secret>password</secret>", "hunter2"},
+		{"placeholders in text", SensitiveData{"user": "alice", "password": "hunter2"}, "login <secret>user</secret>:<secret>password</secret>!", "login alice:hunter2!"},
+		{"unknown name is kept", SensitiveData{"password": "hunter2"}, "<secret>token</secret>", "<secret>token</secret>"},
+		{"empty value", SensitiveData{"empty": ""}, "a<secret>empty</secret>b", "ab"},
+		{"value looking like a placeholder is not expanded again", SensitiveData{"a": "<secret>b</secret>", "b": "x"}, "<secret>a</secret>", "<secret>b</secret>"},
+		{"plain text", SensitiveData{"password": "hunter2"}, "password", "password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.data.Replace(tt.text); got != tt.want {
+				t.Errorf("Replace(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensitiveDataRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		data SensitiveData
+		text string
+		want string
+	}{
+		{"no secrets", nil, "hunter2", "hunter2"},
+		{"one value", SensitiveData{"password": "hunter2"}, "typed hunter2 twice hunter2", "typed <secret>password</secret> twice <secret>password</secret>"},
+		{"empty value is ignored", SensitiveData{"empty": "", "password": "hunter2"}, "hunter2", "<secret>password</secret>"},
+		{"overlapping values, longest wins", SensitiveData{"short": "abc", "long": "abcdef"}, "abcdef abc", "<secret>long</secret> <secret>short</secret>"},
+		{"value inside a longer word", SensitiveData{"pin": "1234"}, "id-12345", "id-<secret>pin</secret>5"},
+		{"placeholders are not redacted again", SensitiveData{"password": "hunter2", "word": "secret"}, "hunter2 secret", "<secret>password</secret> <secret>word</secret>"},
+		{"same value, first name wins", SensitiveData{"b": "xy", "a": "xy"}, "xy", "<secret>a</secret>"},
+		{"replace round trip", SensitiveData{"user": "alice"}, SensitiveData{"user": "alice"}.Replace("<secret>user</secret>"), "<secret>user</secret>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.data.Redact(tt.text); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactParams(t *testing.T) {
+	data := SensitiveData{"password": `p"a<ss>\w`, "user": "alice"}
+	params := struct {
+		Index int
+		Input string
+	}{3, `alice:p"a<ss>\w`}
+	want := `{"Index":3,"Input":"<secret>user</secret>:<secret>password</secret>"}`
+	if got := RedactParams(params, data); got != want {
+		t.Errorf("RedactParams = %s, want %s", got, want)
+	}
+	if got := RedactParams(nil, data); got != "{}" {
+		t.Errorf("RedactParams(nil) = %s", got)
+	}
+}
+
+func TestMessageManagerRedacts(t *testing.T) {
+	m := NewMessageManager(SensitiveData{"password": "hunter2"})
+	m.AddMessage("user", "the field shows hunter2")
+	if got := m.History[0].Content; got != "the field shows <secret>password</secret>" {
+		t.Errorf("history content %q", got)
+	}
+}
+
+func TestLogActionRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+	data := SensitiveData{"password": "hunter2"}
+	params := map[string]any{"Input": "hunter2"}
+	LogAction(l, "input_text", params, data, time.Second, errors.New("could not type hunter2"), "url", "https://example.com")
+	out := buf.String()
+	if strings.Contains(out, "hunter2") {
+		t.Fatalf("secret in log record: %s", out)
+	}
+	for _, want := range []string{"action=input_text", "<secret>password</secret>", "url=https://example.com", "level=ERROR"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log record misses %q: %s", want, out)
+		}
+	}
+}
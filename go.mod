@@ -7,13 +7,16 @@ toolchain go1.23.7
 require (
 	github.com/chromedp/cdproto v0.0.0-20250222051814-50c6cb17f10a
 	github.com/chromedp/chromedp v0.13.1
+	github.com/go-json-experiment/json v0.0.0-20250211171154-1ae217ad3535
+	github.com/peterh/liner v1.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/chromedp/sysutil v1.1.0 // indirect
-	github.com/go-json-experiment/json v0.0.0-20250211171154-1ae217ad3535 // indirect
 	github.com/gobwas/httphead v0.1.0 // indirect
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.4.0 // indirect
+	github.com/mattn/go-runewidth v0.0.3 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 )
@@ -1,61 +1,207 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
 
 	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
 )
 
-// 打开新标签页
-// 获得所有新标签页
-// 如何跳转标签页
-// 如何点击
+// set with -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+const usage = `usage: agent <command> [flags] [args]
+
+commands:
+  run         run an agent task with a model
+  dom         print the interactive elements of a url
+  screenshot  capture a url to a file
+  script      run an action script
+  repl        drive a browser by hand with the registered actions
+  serve       serve browser sessions and actions as a json http api
+  version     print the version
+
+run "agent <command> -h" for the flags of a command, flags default to the AGENT_* environment variables`
+
+type command struct {
+	name string
+	run  func(args []string) error
+}
+
+// the arguments were wrong, reported with exit code 2
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
 
 func main() {
-	b := browser.NewBrowser()
-	// b.GoogleSearch(&browser.GoogleSearchAction{
-	// 	Query: "今天上海的天气",
-	// })
-	// b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{
-	// 	Url: "file:///private/tmp/test.html",
-	// })
-	b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{
-		Url: "http://www.baidu.com",
-	})
-	b.Wait(&browser.WaitScondsParam{
-		Seconds: 1,
-	})
-	b.UpdateState()
-	fmt.Println(b.CachedState.ElemmentTree.GetCliableElementsString())
-	return
-	for id, node := range b.GetState().DomState.SelectorMap {
-		// if node.Attributes["href"] == "" {
-		// 	continue
-		// }
-		// b.ClickElement(&browser.ClickElementParam{
-		// 	Index: id,
-		// })
-		if node.TagName == "input" {
-			b.InputText(&browser.InputTextParam{
-				Index: id,
-				Input: "123",
-			})
+	os.Exit(runMain(os.Args[1:], os.Stderr))
+}
+
+func runMain(args []string, stderr io.Writer) int {
+	commands := []*command{
+		{"run", runCommand},
+		{"dom", domCommand},
+		{"screenshot", screenshotCommand},
+		{"script", scriptCommand},
+		{"repl", replCommand},
+		{"serve", serveCommand},
+		{"version", versionCommand},
+	}
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprintln(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:])
+		var ue *usageError
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &ue):
+			fmt.Fprintf(stderr, "agent %s: %v\n", c.name, err)
+			return 2
+		default:
+			fmt.Fprintf(stderr, "agent %s: %v\n", c.name, err)
+			return 1
 		}
-		return
-	}
-	b.Wait(&browser.WaitScondsParam{
-		Seconds: 2,
-	})
-	b.GoBackward()
-	b.Wait(&browser.WaitScondsParam{
-		Seconds: 2,
-	})
-	b.GoForward()
-	b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{
-		Url: "http://www.baidu.com/ss",
-	})
-	b.CloseCurrentTab()
-	b.GoToUrlInCurrentTab(&browser.GoToUrlInCurrentTabParam{
-		Url: "http://www.baidu.com/sss",
-	})
+	}
+	fmt.Fprintf(stderr, "agent: unknown command %q\n\n%s\n", args[0], usage)
+	return 2
+}
+
+func versionCommand(args []string) error {
+	v := version
+	if v == "" {
+		v = "(devel)"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			v = info.Main.Version
+		}
+	}
+	fmt.Println("agent", v)
+	return nil
+}
+
+func env(name string, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+func envBool(name string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// a repeatable flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// flags every command that starts a browser has
+type browserFlags struct {
+	headless     bool
+	backend      string
+	workspace    string
+	storageState string
+	allowed      listFlag
+	denied       listFlag
+	logLevel     string
+}
+
+func addBrowserFlags(fs *flag.FlagSet) *browserFlags {
+	f := new(browserFlags)
+	fs.BoolVar(&f.headless, "headless", envBool("AGENT_HEADLESS", true), "run chrome without a window [AGENT_HEADLESS]")
+	fs.StringVar(&f.backend, "dom-backend", env("AGENT_DOM_BACKEND", browser.DomBackendScript), "script, accessibility or snapshot [AGENT_DOM_BACKEND]")
+	fs.StringVar(&f.workspace, "workspace", env("AGENT_WORKSPACE", ""), "directory of the files actions save [AGENT_WORKSPACE]")
+	fs.StringVar(&f.storageState, "storage-state", env("AGENT_STORAGE_STATE", ""), "cookies and storage loaded at start [AGENT_STORAGE_STATE]")
+	fs.Var(&f.allowed, "allow-domain", "only navigate to this domain, repeatable")
+	fs.Var(&f.denied, "deny-domain", "never navigate to this domain, repeatable")
+	fs.StringVar(&f.logLevel, "log-level", env("AGENT_LOG_LEVEL", "warn"), "debug, info, warn or error, logs go to stderr [AGENT_LOG_LEVEL]")
+	return f
+}
+
+func (f *browserFlags) config() (*browser.BrowserConfig, error) {
+	switch f.backend {
+	case browser.DomBackendScript, browser.DomBackendAccessibility, browser.DomBackendSnapshot:
+	default:
+		return nil, &usageError{fmt.Errorf("unknown dom backend %q", f.backend)}
+	}
+	if f.storageState != "" {
+		// fail before chrome starts
+		if _, err := os.Stat(f.storageState); err != nil {
+			return nil, fmt.Errorf("storage state: %w", err)
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(f.logLevel)); err != nil {
+		return nil, &usageError{fmt.Errorf("invalid log level %q", f.logLevel)}
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	controller.SetLogger(logger)
+	config := browser.DefaultBrowserConfig()
+	config.Headless = f.headless
+	config.DomBackend = f.backend
+	config.WorkspaceDir = f.workspace
+	config.StorageStatePath = f.storageState
+	config.AllowedDomains = f.allowed
+	config.DeniedDomains = f.denied
+	config.Logger = logger
+	return config, nil
+}
+
+// parse the flags, wrong flags are a usage error
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{err}
+	}
+	return nil
 }
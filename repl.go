@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/peterh/liner"
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+	"lizhanpeng.org/lizhanpeng/agent/script"
+)
+
+const replHelp = `<action> {"Field": value}     run a registered action with json params
+<action> field=value ...       or with key=value params, quote values with spaces
+.actions                       list the actions and their params
+.state                         print the elements and tabs again
+.save <file.json|file.yaml>    save the actions run so far as a script
+.help                          this help
+.quit                          close the browser and leave`
+
+var replCommands = []string{".actions", ".state", ".save", ".help", ".quit"}
+
+func replCommand(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	bf := addBrowserFlags(fs)
+	home, _ := os.UserHomeDir()
+	historyPath := fs.String("history-file", env("AGENT_REPL_HISTORY", filepath.Join(home, ".agent_history")), "line history kept between sessions, empty for none [AGENT_REPL_HISTORY]")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: agent repl [flags] [url]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return &usageError{errors.New("give at most one url")}
+	}
+	config, err := bf.config()
+	if err != nil {
+		return err
+	}
+	b := browser.NewBrowserWithConfig(config)
+	defer b.Close()
+	if err := b.Start(); err != nil {
+		return err
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetCompleter(completeLine)
+	if *historyPath != "" {
+		if f, err := os.Open(*historyPath); err == nil {
+			_, _ = line.ReadHistory(f)
+			f.Close()
+		}
+		defer func() {
+			if f, err := os.Create(*historyPath); err == nil {
+				_, _ = line.WriteHistory(f)
+				f.Close()
+			}
+		}()
+	}
+
+	session := &script.Script{Name: "repl session"}
+	if fs.NArg() == 1 {
+		step := &script.Step{Action: "go_to_url", Params: map[string]any{"Url": fs.Arg(0)}}
+		if err := runStep(b, step, session); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+	}
+	fmt.Println(`type .help for help, tab completes action names`)
+	for {
+		input, err := line.Prompt("> ")
+		if errors.Is(err, io.EOF) || errors.Is(err, liner.ErrPromptAborted) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+		name, rest, _ := strings.Cut(input, " ")
+		switch name {
+		case ".quit", ".exit":
+			return nil
+		case ".help":
+			fmt.Println(replHelp)
+		case ".actions":
+			for _, action := range controller.GetActions() {
+				if action.Handler != nil {
+					fmt.Println(action.Prompt())
+				}
+			}
+		case ".state":
+			if err := printState(b); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		case ".save":
+			path := strings.TrimSpace(rest)
+			if path == "" {
+				fmt.Fprintln(os.Stderr, "error: .save needs a file")
+				continue
+			}
+			if err := session.Save(path); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				continue
+			}
+			fmt.Printf("saved %d steps to %s\n", len(session.Steps), path)
+		default:
+			params, err := parseParams(rest)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				continue
+			}
+			if err := runStep(b, &script.Step{Action: name, Params: params}, session); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+	}
+}
+
+// run the action, record it in the session when it worked and print the new state
+func runStep(b *browser.Browser, step *script.Step, session *script.Script) error {
+	action := controller.GetAction(step.Action)
+	if action == nil || action.Handler == nil {
+		return fmt.Errorf("unknown action %q, see .actions", step.Action)
+	}
+	result, err := action.Execute(b.Logger, b.SensitiveData, b, step.Params)
+	if err != nil {
+		return err
+	}
+	session.Steps = append(session.Steps, step)
+	if result.ExtractedContent != "" {
+		fmt.Println(result.ExtractedContent)
+	}
+	return printState(b)
+}
+
+func printState(b *browser.Browser) error {
+	if err := b.UpdateState(); err != nil {
+		return err
+	}
+	state := b.GetState()
+	if state.ElemmentTree != nil {
+		elements, err := state.ElemmentTree.GetCliableElementsString()
+		if err != nil {
+			return err
+		}
+		fmt.Println(elements)
+	}
+	fmt.Println("tabs:")
+	for _, tab := range state.Tabs {
+		fmt.Printf("[%d] %s %s\n", tab.PageId, tab.Title, tab.Url)
+	}
+	fmt.Println("url:", state.Url)
+	return nil
+}
+
+// action names for the first word, param names after it
+func completeLine(line string) []string {
+	name, rest, found := strings.Cut(line, " ")
+	if !found {
+		ret := make([]string, 0)
+		for _, action := range controller.GetActions() {
+			if action.Handler != nil && strings.HasPrefix(action.Name, name) {
+				ret = append(ret, action.Name+" ")
+			}
+		}
+		for _, command := range replCommands {
+			if strings.HasPrefix(command, name) {
+				ret = append(ret, command+" ")
+			}
+		}
+		return ret
+	}
+	action := controller.GetAction(name)
+	if action == nil || strings.HasPrefix(strings.TrimSpace(rest), "{") {
+		return nil
+	}
+	// complete the last word of key=value params
+	head, last := "", rest
+	if i := strings.LastIndex(rest, " "); i >= 0 {
+		head, last = rest[:i+1], rest[i+1:]
+	}
+	if strings.Contains(last, "=") {
+		return nil
+	}
+	ret := make([]string, 0)
+	for _, field := range action.ParamNames() {
+		if strings.HasPrefix(strings.ToLower(field), strings.ToLower(last)) {
+			ret = append(ret, name+" "+head+field+"=")
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// params as a json object or as key=value pairs, values are json when they parse and strings otherwise
+func parseParams(text string) (map[string]any, error) {
+	text = strings.TrimSpace(text)
+	params := make(map[string]any)
+	if text == "" {
+		return params, nil
+	}
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &params); err != nil {
+			return nil, fmt.Errorf("invalid json params: %w", err)
+		}
+		return params, nil
+	}
+	words, err := splitWords(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, word := range words {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q is not key=value", word)
+		}
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value of %s: %w", key, err)
+			}
+			params[key] = unquoted
+			continue
+		}
+		var v any
+		if err := json.Unmarshal([]byte(value), &v); err == nil {
+			params[key] = v
+		} else {
+			params[key] = value
+		}
+	}
+	return params, nil
+}
+
+// split at spaces outside of double quotes, the quotes are kept
+func splitWords(text string) ([]string, error) {
+	words := make([]string, 0)
+	var current strings.Builder
+	quoted, escaped := false, false
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if current.Len() > 0 {
+				words = append(words, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteRune(r)
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if current.Len() > 0 {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	cases := []struct {
+		text string
+		want map[string]any
+	}{
+		{``, map[string]any{}},
+		{`{"Index": 3, "Input": "hello world"}`, map[string]any{"Index": 3.0, "Input": "hello world"}},
+		{`index=3 input="hello world"`, map[string]any{"index": 3.0, "input": "hello world"}},
+		{`url=https://example.com/?q=a=b fullpage=true`, map[string]any{"url": "https://example.com/?q=a=b", "fullpage": true}},
+		{`text="say \"hi\""`, map[string]any{"text": `say "hi"`}},
+	}
+	for _, c := range cases {
+		got, err := parseParams(c.text)
+		if err != nil {
+			t.Errorf("parseParams(%s): %v", c.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseParams(%s) = %v, want %v", c.text, got, c.want)
+		}
+	}
+	for _, text := range []string{`index`, `input="open`, `{"index": }`} {
+		if _, err := parseParams(text); err == nil {
+			t.Errorf("parseParams(%s) gave no error", text)
+		}
+	}
+}
+
+func TestCompleteLine(t *testing.T) {
+	got := completeLine("go_")
+	want := []string{"go_back ", "go_forward ", "go_to_url "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("completeLine(go_) = %v, want %v", got, want)
+	}
+	got = completeLine("input_text index=1 inp")
+	want = []string{"input_text index=1 Input="}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("completeLine(input_text index=1 inp) = %v, want %v", got, want)
+	}
+}
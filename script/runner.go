@@ -0,0 +1,216 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+// params holding the highlight index of an element of the state
+var indexParams = []string{"index", "sourceindex", "targetindex"}
+
+// runs scripts on a browser through the action registry
+type Runner struct {
+	Browser   *browser.Browser
+	Variables map[string]string // take precedence over the script's, extracted values are saved here
+	Logger    *slog.Logger      // the browser's logger by default
+}
+
+func NewRunner(b *browser.Browser) *Runner {
+	r := new(Runner)
+	r.Browser = b
+	r.Variables = make(map[string]string)
+	r.Logger = b.Logger
+	if r.Logger == nil {
+		r.Logger = controller.DiscardLogger()
+	}
+	return r
+}
+
+// a step failed, steps count from 1
+type StepError struct {
+	Step int
+	Name string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d %s: %v", e.Step, e.Name, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// run the steps in order and stop at the first failing one with a *StepError,
+// the results of the actions that ran are returned
+func (r *Runner) Run(s *Script) ([]*controller.ActionResult, error) {
+	// runners may be built without NewRunner
+	if r.Logger == nil {
+		r.Logger = controller.DiscardLogger()
+	}
+	variables := make(map[string]string, len(s.Variables)+len(r.Variables))
+	for name, value := range s.Variables {
+		variables[name] = value
+	}
+	for name, value := range r.Variables {
+		variables[name] = value
+	}
+	results := make([]*controller.ActionResult, 0, len(s.Steps))
+	for i, step := range s.Steps {
+		name := step.Name
+		if name == "" {
+			name = step.Action
+		}
+		if name == "" {
+			name = "assert"
+		}
+		start := time.Now()
+		result, err := r.runStep(step, variables)
+		if err != nil {
+			r.Logger.Error("script step failed", "script", s.Name, "step", i+1, "name", name, "error", err)
+			return results, &StepError{Step: i + 1, Name: name, Err: err}
+		}
+		r.Logger.Info("script step", "script", s.Name, "step", i+1, "name", name, "duration", time.Since(start))
+		if result != nil {
+			results = append(results, result)
+			if step.Save != "" {
+				variables[step.Save] = result.ExtractedContent
+				if r.Variables != nil {
+					r.Variables[step.Save] = result.ExtractedContent
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+func (r *Runner) runStep(step *Step, variables map[string]string) (*controller.ActionResult, error) {
+	if step.Assert != nil {
+		return nil, r.check(step.Assert, variables)
+	}
+	action := controller.GetAction(step.Action)
+	if action == nil {
+		return nil, fmt.Errorf("unknown action %q", step.Action)
+	}
+	params, err := expandValue(step.Params, variables)
+	if err != nil {
+		return nil, err
+	}
+	if usesIndex(step.Params) {
+		// indices refer to the elements of the current state
+		if err := r.Browser.UpdateState(); err != nil {
+			return nil, err
+		}
+	}
+	var sensitiveData controller.SensitiveData
+	if r.Browser != nil {
+		sensitiveData = r.Browser.SensitiveData
+	}
+	return action.Execute(r.Logger, sensitiveData, r.Browser, params)
+}
+
+func usesIndex(params map[string]any) bool {
+	for key := range params {
+		for _, name := range indexParams {
+			if strings.EqualFold(key, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *Runner) check(a *Assertion, variables map[string]string) error {
+	var expandErr error
+	expandText := func(text string) string {
+		ret, err := expand(text, variables)
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+		return ret
+	}
+	contains := []struct {
+		what       string
+		expression string
+		want       string
+	}{
+		{"url", "location.href", expandText(a.UrlContains)},
+		{"title", "document.title", expandText(a.TitleContains)},
+		{"page text", `document.body ? document.body.innerText : ""`, expandText(a.TextContains)},
+	}
+	selectors := []struct {
+		selector string
+		exists   bool
+	}{
+		{expandText(a.Exists), true},
+		{expandText(a.NotExists), false},
+	}
+	equals, wantContained := expandText(a.Equals), expandText(a.Contains)
+	if expandErr != nil {
+		return expandErr
+	}
+	for _, c := range contains {
+		if c.want == "" {
+			continue
+		}
+		if err := r.checkContains(c.what, c.expression, c.want); err != nil {
+			return err
+		}
+	}
+	for _, c := range selectors {
+		if c.selector == "" {
+			continue
+		}
+		var exists bool
+		if err := r.evaluate(fmt.Sprintf("!!document.querySelector(%s)", browser.JsString(c.selector)), &exists); err != nil {
+			return err
+		}
+		if exists && !c.exists {
+			return fmt.Errorf("an element matches %q", c.selector)
+		}
+		if !exists && c.exists {
+			return fmt.Errorf("no element matches %q", c.selector)
+		}
+	}
+	if a.Variable != "" {
+		value, ok := variables[a.Variable]
+		if !ok {
+			return fmt.Errorf("undefined variable %s", a.Variable)
+		}
+		if equals != "" && value != equals {
+			return fmt.Errorf("variable %s is %q, want %q", a.Variable, value, equals)
+		}
+		if wantContained != "" && !strings.Contains(value, wantContained) {
+			return fmt.Errorf("variable %s is %q, want it to contain %q", a.Variable, value, wantContained)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) checkContains(what string, expression string, want string) error {
+	var got string
+	if err := r.evaluate(expression, &got); err != nil {
+		return err
+	}
+	if !strings.Contains(got, want) {
+		if len(got) > 200 {
+			got = got[:200] + "..."
+		}
+		return fmt.Errorf("%s %q does not contain %q", what, got, want)
+	}
+	return nil
+}
+
+func (r *Runner) evaluate(expression string, out any) error {
+	data, err := r.Browser.ExecJavascript(&browser.ExecJavascriptParam{Content: expression})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
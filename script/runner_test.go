@@ -0,0 +1,43 @@
+package script
+
+import (
+	"testing"
+
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+type echoParam struct {
+	Text string
+}
+
+func init() {
+	// an action that does not need chrome
+	controller.RegistryAction("test_echo", "Echo the text", new(echoParam), func(_ any, params any) (*controller.ActionResult, error) {
+		return &controller.ActionResult{ExtractedContent: params.(*echoParam).Text}, nil
+	})
+}
+
+func TestRunnerLiteral(t *testing.T) {
+	s := &Script{
+		Variables: map[string]string{"user": "alice"},
+		Steps: []*Step{
+			{Action: "test_echo", Params: map[string]any{"text": "hello ${user}"}, Save: "greeting"},
+			{Assert: &Assertion{Variable: "greeting", Equals: "hello ${user}"}},
+		},
+	}
+	// without variables the saved value stays in the run
+	results, err := (&Runner{}).Run(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Errorf("%d results", len(results))
+	}
+	r := &Runner{Variables: map[string]string{}}
+	if _, err := r.Run(s); err != nil {
+		t.Fatal(err)
+	}
+	if r.Variables["greeting"] != "hello alice" {
+		t.Errorf("variables %v", r.Variables)
+	}
+}
@@ -0,0 +1,146 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// a deterministic flow of registered actions, run without a model
+type Script struct {
+	Name      string            `json:"name" yaml:"name"`
+	Variables map[string]string `json:"variables" yaml:"variables"` // ${name} in params and assertions
+	Steps     []*Step           `json:"steps" yaml:"steps"`
+}
+
+// one action or one assertion
+type Step struct {
+	Name   string         `json:"name,omitempty" yaml:"name,omitempty"`     // shown in errors
+	Action string         `json:"action,omitempty" yaml:"action,omitempty"` // a registered action like go_to_url
+	Params map[string]any `json:"params,omitempty" yaml:"params,omitempty"` // fields of the action's params, case insensitive
+	Save   string         `json:"save,omitempty" yaml:"save,omitempty"`     // variable set to the content the action extracted
+	Assert *Assertion     `json:"assert,omitempty" yaml:"assert,omitempty"`
+}
+
+// every condition given has to hold
+type Assertion struct {
+	UrlContains   string `json:"url_contains,omitempty" yaml:"url_contains,omitempty"`
+	TitleContains string `json:"title_contains,omitempty" yaml:"title_contains,omitempty"`
+	TextContains  string `json:"text_contains,omitempty" yaml:"text_contains,omitempty"` // text of the page
+	Exists        string `json:"exists,omitempty" yaml:"exists,omitempty"`               // css selector
+	NotExists     string `json:"not_exists,omitempty" yaml:"not_exists,omitempty"`       // css selector
+	Variable      string `json:"variable,omitempty" yaml:"variable,omitempty"`           // compared with Equals or Contains
+	Equals        string `json:"equals,omitempty" yaml:"equals,omitempty"`
+	Contains      string `json:"contains,omitempty" yaml:"contains,omitempty"`
+}
+
+// load a script file, .yaml and .yml files are yaml and others json
+func Load(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "json"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	}
+	s, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// write the script, as yaml to .yaml and .yml files and as json to others
+func (s *Script) Save(path string) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(s)
+	default:
+		data, err = json.MarshalIndent(s, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// parse a script in json or yaml and check its steps
+func Parse(data []byte, format string) (*Script, error) {
+	s := new(Script)
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, s)
+	case "yaml":
+		err = yaml.Unmarshal(data, s)
+	default:
+		return nil, fmt.Errorf("unknown script format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	for i, step := range s.Steps {
+		if step == nil || (step.Action == "") == (step.Assert == nil) {
+			return nil, fmt.Errorf("step %d needs either an action or an assertion", i+1)
+		}
+	}
+	return s, nil
+}
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+
+// replace the ${name} references, unknown names are an error
+func expand(text string, variables map[string]string) (string, error) {
+	var missing []string
+	ret := variablePattern.ReplaceAllStringFunc(text, func(ref string) string {
+		name := variablePattern.FindStringSubmatch(ref)[1]
+		value, ok := variables[name]
+		if !ok {
+			missing = append(missing, name)
+			return ref
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable %s", strings.Join(missing, ", "))
+	}
+	return ret, nil
+}
+
+// expand the strings in params, maps and lists included
+func expandValue(v any, variables map[string]string) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return expand(v, variables)
+	case map[string]any:
+		ret := make(map[string]any, len(v))
+		for key, value := range v {
+			expanded, err := expandValue(value, variables)
+			if err != nil {
+				return nil, err
+			}
+			ret[key] = expanded
+		}
+		return ret, nil
+	case []any:
+		ret := make([]any, len(v))
+		for i, value := range v {
+			expanded, err := expandValue(value, variables)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = expanded
+		}
+		return ret, nil
+	}
+	return v, nil
+}
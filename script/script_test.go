@@ -0,0 +1,106 @@
+package script
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const loginJson = `{
+	"name": "login",
+	"variables": {"base": "https://example.com", "user": "alice"},
+	"steps": [
+		{"action": "go_to_url", "params": {"url": "${base}/login"}},
+		{"action": "input_text", "params": {"selector": "#user", "input": "${user}"}},
+		{"action": "click_element", "params": {"index": 3}},
+		{"action": "extract", "params": {"selector": ".welcome"}, "save": "greeting"},
+		{"assert": {"url_contains": "/home", "variable": "greeting", "contains": "${user}"}}
+	]
+}`
+
+const loginYaml = `
+name: login
+variables:
+  base: https://example.com
+  user: alice
+steps:
+  - action: go_to_url
+    params: {url: "${base}/login"}
+  - action: input_text
+    params:
+      selector: "#user"
+      input: ${user}
+  - action: click_element
+    params: {index: 3}
+  - action: extract
+    params: {selector: .welcome}
+    save: greeting
+  - assert:
+      url_contains: /home
+      variable: greeting
+      contains: ${user}
+`
+
+// both formats give the same script, numbers of json and yaml aside
+func TestParseFormats(t *testing.T) {
+	fromJson, err := Parse([]byte(loginJson), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromYaml, err := Parse([]byte(loginYaml), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromJson.Steps) != 5 || len(fromYaml.Steps) != 5 {
+		t.Fatalf("got %d and %d steps, want 5", len(fromJson.Steps), len(fromYaml.Steps))
+	}
+	for i := range fromJson.Steps {
+		j, y := fromJson.Steps[i], fromYaml.Steps[i]
+		if j.Action != y.Action || j.Save != y.Save || !reflect.DeepEqual(j.Assert, y.Assert) {
+			t.Errorf("step %d differs: %+v %+v", i+1, j, y)
+		}
+	}
+	if !reflect.DeepEqual(fromJson.Variables, fromYaml.Variables) {
+		t.Errorf("variables differ: %v %v", fromJson.Variables, fromYaml.Variables)
+	}
+	if !usesIndex(fromYaml.Steps[2].Params) || usesIndex(fromYaml.Steps[1].Params) {
+		t.Errorf("only the click uses an index")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := map[string]string{
+		`{"steps": [{"name": "nothing"}]}`: "step 1 needs either an action or an assertion",
+		`{"steps": [{"action": "go_back"}, {"action": "go_back", "assert": {"exists": "a"}}]}`: "step 2 needs either an action or an assertion",
+		`{"steps": [`: "invalid script",
+	}
+	for payload, want := range cases {
+		_, err := Parse([]byte(payload), "json")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%s) = %v, want %q", payload, err, want)
+		}
+	}
+}
+
+func TestExpandValue(t *testing.T) {
+	variables := map[string]string{"host": "example.com", "q": "go"}
+	got, err := expandValue(map[string]any{
+		"url":   "https://${host}/search?q=${q}",
+		"list":  []any{"${q}", 1.0},
+		"count": 2,
+	}, variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"url":   "https://example.com/search?q=go",
+		"list":  []any{"go", 1.0},
+		"count": 2,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := expandValue("${missing}", variables); err == nil || !strings.Contains(err.Error(), "undefined variable missing") {
+		t.Errorf("got %v, want an undefined variable error", err)
+	}
+}
@@ -0,0 +1,494 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+type Options struct {
+	Config         *browser.BrowserConfig // copied for every session, see sessionConfig
+	RequestTimeout time.Duration          // a request waiting longer is answered with 504, 0 for no limit
+	IdleTimeout    time.Duration          // sessions unused this long are closed, 0 keeps them
+	MaxSessions    int                    // 0 for no limit
+	Token          string                 // requests need the header Authorization: Bearer <token>, empty for no check
+	Logger         *slog.Logger
+}
+
+func DefaultOptions() *Options {
+	return &Options{
+		Config:         browser.DefaultBrowserConfig(),
+		RequestTimeout: time.Minute,
+		IdleTimeout:    10 * time.Minute,
+	}
+}
+
+var (
+	errNotFound = errors.New("not found")
+	errTimeout  = errors.New("the request timed out")
+)
+
+// the browser sessions served over http
+type Server struct {
+	options  *Options
+	logger   *slog.Logger
+	mutex    sync.Mutex
+	sessions map[string]*session
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type session struct {
+	id       string
+	browser  *browser.Browser
+	busy     chan struct{} // one request uses the browser at a time
+	created  time.Time
+	lastUsed time.Time // guarded by the server mutex
+	closing  bool      // closed by the request holding busy when it returns, guarded by the server mutex
+}
+
+// the session as the api shows it
+type SessionInfo struct {
+	Id        string    `json:"id"`
+	Created   time.Time `json:"created"`
+	LastUsed  time.Time `json:"last_used"`
+	Workspace string    `json:"workspace"`     // directory of the files the actions save
+	HarPath   string    `json:"har,omitempty"` // written when the session is closed
+}
+
+type TabInfo struct {
+	PageId int    `json:"page_id"`
+	Url    string `json:"url"`
+	Title  string `json:"title"`
+}
+
+type StateResponse struct {
+	Url           string                    `json:"url"`
+	Title         string                    `json:"title"`
+	Tabs          []*TabInfo                `json:"tabs"`
+	Elements      string                    `json:"elements"`             // serialized with the configured dom serializer
+	Screenshot    []byte                    `json:"screenshot,omitempty"` // base64 in json
+	PixelsAbove   int                       `json:"pixels_above"`
+	PixelsBelow   int                       `json:"pixels_below"`
+	ConsoleErrors []*browser.ConsoleMessage `json:"console_errors,omitempty"`
+}
+
+type ActionInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Params      map[string]any `json:"params"` // json schema
+}
+
+type ActionResponse struct {
+	IsDone           bool     `json:"is_done"`
+	Success          bool     `json:"success"`
+	ExtractedContent string   `json:"extracted_content,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	Attachments      []string `json:"attachments,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// a server without sessions, idle sessions are closed in the background until Close
+func New(options *Options) *Server {
+	if options == nil {
+		options = DefaultOptions()
+	}
+	if options.Config == nil {
+		options.Config = browser.DefaultBrowserConfig()
+	}
+	s := &Server{
+		options:  options,
+		logger:   options.Logger,
+		sessions: make(map[string]*session),
+		stop:     make(chan struct{}),
+	}
+	if s.logger == nil {
+		s.logger = controller.DiscardLogger()
+	}
+	if options.IdleTimeout > 0 {
+		go s.expireLoop()
+	}
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /actions", s.listActions)
+	mux.HandleFunc("GET /sessions", s.listSessions)
+	mux.HandleFunc("POST /sessions", s.createSession)
+	mux.HandleFunc("DELETE /sessions/{id}", s.closeSession)
+	mux.HandleFunc("GET /sessions/{id}/state", s.getState)
+	mux.HandleFunc("POST /sessions/{id}/actions/{name}", s.executeAction)
+	if s.options.Token == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.options.Token)) == 1
+}
+
+// close every session and stop expiring them
+func (s *Server) Close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.mutex.Lock()
+	sessions := s.sessions
+	s.sessions = make(map[string]*session)
+	s.mutex.Unlock()
+	var errs []error
+	for _, ss := range sessions {
+		if s.takeForClose(ss) {
+			errs = append(errs, ss.browser.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// take the removed session to close it, or leave closing it to the request using it.
+// true when taken
+func (s *Server) takeForClose(ss *session) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	select {
+	case ss.busy <- struct{}{}:
+		return true
+	default:
+		ss.closing = true
+		return false
+	}
+}
+
+func (s *Server) closeBrowser(ss *session) {
+	if err := ss.browser.Close(); err != nil {
+		s.logger.Warn("close session", "id", ss.id, "error", err)
+	}
+	s.logger.Info("session closed", "id", ss.id)
+}
+
+func (s *Server) expireLoop() {
+	ticker := time.NewTicker(max(s.options.IdleTimeout/4, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.expire(now)
+		}
+	}
+}
+
+// close the sessions idle since before now minus the idle timeout, busy sessions are kept
+func (s *Server) expire(now time.Time) {
+	expired := make([]*session, 0)
+	s.mutex.Lock()
+	for id, ss := range s.sessions {
+		if now.Sub(ss.lastUsed) < s.options.IdleTimeout {
+			continue
+		}
+		select {
+		case ss.busy <- struct{}{}:
+			delete(s.sessions, id)
+			expired = append(expired, ss)
+		default:
+		}
+	}
+	s.mutex.Unlock()
+	for _, ss := range expired {
+		s.logger.Info("session expired", "id", ss.id)
+		if err := ss.browser.Close(); err != nil {
+			s.logger.Warn("close expired session", "id", ss.id, "error", err)
+		}
+	}
+}
+
+func newSessionId() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (s *Server) info(ss *session) *SessionInfo {
+	return &SessionInfo{
+		Id:        ss.id,
+		Created:   ss.created,
+		LastUsed:  ss.lastUsed,
+		Workspace: ss.browser.Config.WorkspaceDir,
+		HarPath:   ss.browser.Config.HarPath,
+	}
+}
+
+// the config of a session, the files it writes get their own paths so sessions do not overwrite
+// each other's HAR file or workspace files. the storage state file is only read and stays shared
+func sessionConfig(base *browser.BrowserConfig, id string) *browser.BrowserConfig {
+	config := *base
+	if config.HarPath != "" {
+		ext := filepath.Ext(config.HarPath)
+		config.HarPath = strings.TrimSuffix(config.HarPath, ext) + "-" + id + ext
+	}
+	workspace := config.WorkspaceDir
+	if workspace == "" {
+		workspace = "."
+	}
+	config.WorkspaceDir = filepath.Join(workspace, id)
+	return &config
+}
+
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	if s.options.MaxSessions > 0 && len(s.sessions) >= s.options.MaxSessions {
+		s.mutex.Unlock()
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("at most %d sessions", s.options.MaxSessions))
+		return
+	}
+	// chrome starts with the first request that needs a page
+	id := newSessionId()
+	now := time.Now()
+	ss := &session{
+		id:       id,
+		browser:  browser.NewBrowserWithConfig(sessionConfig(s.options.Config, id)),
+		busy:     make(chan struct{}, 1),
+		created:  now,
+		lastUsed: now,
+	}
+	s.sessions[ss.id] = ss
+	info := s.info(ss)
+	s.mutex.Unlock()
+	s.logger.Info("session created", "id", ss.id)
+	writeJson(w, http.StatusCreated, info)
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	ret := make([]*SessionInfo, 0, len(s.sessions))
+	for _, ss := range s.sessions {
+		ret = append(ret, s.info(ss))
+	}
+	s.mutex.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Created.Before(ret[j].Created) })
+	writeJson(w, http.StatusOK, ret)
+}
+
+func (s *Server) closeSession(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mutex.Lock()
+	ss, ok := s.sessions[id]
+	delete(s.sessions, id)
+	s.mutex.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session %s %w", id, errNotFound))
+		return
+	}
+	// let a running request finish before the browser goes away
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	select {
+	case ss.busy <- struct{}{}:
+	case <-ctx.Done():
+		if !s.takeForClose(ss) {
+			s.logger.Warn("session is closed when its request returns", "id", id)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+	s.closeBrowser(ss)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listActions(w http.ResponseWriter, r *http.Request) {
+	ret := make([]*ActionInfo, 0)
+	for _, action := range controller.GetActions() {
+		if action.Handler == nil {
+			continue
+		}
+		ret = append(ret, &ActionInfo{
+			Name:        action.Name,
+			Description: action.Description,
+			Params:      action.Schema(),
+		})
+	}
+	writeJson(w, http.StatusOK, ret)
+}
+
+// ?screenshot=false leaves the screenshot out
+func (s *Server) getState(w http.ResponseWriter, r *http.Request) {
+	withScreenshot := r.URL.Query().Get("screenshot") != "false"
+	var ret *StateResponse
+	err := s.withSession(r, func(b *browser.Browser) error {
+		if err := b.UpdateState(); err != nil {
+			return err
+		}
+		state := b.GetState()
+		elements, err := b.SerializeElements(state)
+		if err != nil {
+			return err
+		}
+		ret = &StateResponse{
+			Url:           state.Url,
+			Title:         state.Title,
+			Tabs:          make([]*TabInfo, 0, len(state.Tabs)),
+			Elements:      elements,
+			PixelsAbove:   state.PixelsAbove,
+			PixelsBelow:   state.PixelBelow,
+			ConsoleErrors: state.ConsoleErrors,
+		}
+		if withScreenshot {
+			ret.Screenshot = state.ScreentShot
+		}
+		for _, tab := range state.Tabs {
+			ret.Tabs = append(ret.Tabs, &TabInfo{PageId: tab.PageId, Url: tab.Url, Title: tab.Title})
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJson(w, http.StatusOK, ret)
+}
+
+// the body is the params object of the action, empty for actions without params
+func (s *Server) executeAction(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	action := controller.GetAction(name)
+	if action == nil || action.Handler == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("action %s %w", name, errNotFound))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var params any
+	if len(body) > 0 {
+		params = json.RawMessage(body)
+	}
+	// bad params are found before a session is used
+	if params, err = action.DecodeParams(params); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var result *controller.ActionResult
+	err = s.withSession(r, func(b *browser.Browser) error {
+		var err error
+		result, err = action.Execute(s.logger, b.SensitiveData, b, params)
+		return err
+	})
+	if err != nil {
+		status := statusOf(err)
+		if status == http.StatusInternalServerError {
+			// the action ran and failed
+			status = http.StatusUnprocessableEntity
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJson(w, http.StatusOK, &ActionResponse{
+		IsDone:           result.IsDone,
+		Success:          result.Success,
+		ExtractedContent: result.ExtractedContent,
+		Error:            result.Error,
+		Attachments:      result.Attachments,
+	})
+}
+
+// run f with the browser of the session in the path. chromedp calls can not be cancelled from
+// here, so on timeout the request is answered and f keeps the session busy until it returns.
+// a session closed meanwhile is closed when f returns
+func (s *Server) withSession(r *http.Request, f func(b *browser.Browser) error) error {
+	id := r.PathValue("id")
+	s.mutex.Lock()
+	ss, ok := s.sessions[id]
+	if ok {
+		ss.lastUsed = time.Now()
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("session %s %w", id, errNotFound)
+	}
+	ctx, cancel := s.requestContext(r)
+	defer cancel()
+	select {
+	case ss.busy <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("session %s is busy: %w", id, errTimeout)
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			s.mutex.Lock()
+			ss.lastUsed = time.Now()
+			closing := ss.closing
+			if !closing {
+				<-ss.busy
+			}
+			s.mutex.Unlock()
+			if closing {
+				s.closeBrowser(ss)
+			}
+		}()
+		done <- f(ss.browser)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errTimeout
+	}
+}
+
+// the context of the request with the request timeout, a timeout of 0 waits as long as the client
+func (s *Server) requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if s.options.RequestTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), s.options.RequestTimeout)
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, &errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lizhanpeng.org/lizhanpeng/agent/browser"
+	"lizhanpeng.org/lizhanpeng/agent/controller"
+)
+
+type echoParam struct {
+	Text  string
+	Delay int // milliseconds
+}
+
+func init() {
+	// actions that do not need chrome
+	controller.RegistryAction("test_echo", "Echo the text", new(echoParam), func(_ any, params any) (*controller.ActionResult, error) {
+		param := params.(*echoParam)
+		time.Sleep(time.Duration(param.Delay) * time.Millisecond)
+		return &controller.ActionResult{ExtractedContent: param.Text, Success: true}, nil
+	})
+}
+
+func newTestServer(t *testing.T, options *Options) (*Server, *httptest.Server) {
+	s := New(options)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return s, ts
+}
+
+func request(t *testing.T, method string, url string, body string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestSessions(t *testing.T) {
+	_, ts := newTestServer(t, &Options{RequestTimeout: time.Second, MaxSessions: 1})
+	var info SessionInfo
+	if status := request(t, "POST", ts.URL+"/sessions", "", &info); status != http.StatusCreated || info.Id == "" {
+		t.Fatalf("create: status %d, %+v", status, info)
+	}
+	var e errorResponse
+	if status := request(t, "POST", ts.URL+"/sessions", "", &e); status != http.StatusServiceUnavailable {
+		t.Fatalf("create over the limit: status %d", status)
+	}
+	var list []*SessionInfo
+	if request(t, "GET", ts.URL+"/sessions", "", &list); len(list) != 1 || list[0].Id != info.Id {
+		t.Fatalf("list: %+v", list)
+	}
+	if status := request(t, "DELETE", ts.URL+"/sessions/"+info.Id, "", nil); status != http.StatusNoContent {
+		t.Fatalf("close: status %d", status)
+	}
+	if status := request(t, "DELETE", ts.URL+"/sessions/"+info.Id, "", &e); status != http.StatusNotFound {
+		t.Fatalf("close again: status %d", status)
+	}
+	if status := request(t, "GET", ts.URL+"/sessions/"+info.Id+"/state", "", &e); status != http.StatusNotFound {
+		t.Fatalf("state of a closed session: status %d", status)
+	}
+}
+
+func TestActions(t *testing.T) {
+	_, ts := newTestServer(t, &Options{RequestTimeout: time.Second})
+	var actions []*ActionInfo
+	request(t, "GET", ts.URL+"/actions", "", &actions)
+	var echo *ActionInfo
+	for _, action := range actions {
+		if action.Name == "test_echo" {
+			echo = action
+		}
+	}
+	if echo == nil {
+		t.Fatalf("test_echo is not listed in %d actions", len(actions))
+	}
+	properties := echo.Params["properties"].(map[string]any)
+	if properties["Delay"].(map[string]any)["type"] != "integer" || properties["Text"].(map[string]any)["type"] != "string" {
+		t.Errorf("schema %+v", echo.Params)
+	}
+
+	var info SessionInfo
+	request(t, "POST", ts.URL+"/sessions", "", &info)
+	base := ts.URL + "/sessions/" + info.Id + "/actions/"
+	var result ActionResponse
+	if status := request(t, "POST", base+"test_echo", `{"text": "hello"}`, &result); status != http.StatusOK || result.ExtractedContent != "hello" {
+		t.Errorf("execute: status %d, %+v", status, result)
+	}
+	var e errorResponse
+	if status := request(t, "POST", base+"test_echo", `{"text": 1}`, &e); status != http.StatusBadRequest {
+		t.Errorf("bad params: status %d", status)
+	}
+	if status := request(t, "POST", base+"no_such_action", "", &e); status != http.StatusNotFound {
+		t.Errorf("unknown action: status %d", status)
+	}
+	if status := request(t, "POST", ts.URL+"/sessions/nope/actions/test_echo", "", &e); status != http.StatusNotFound {
+		t.Errorf("unknown session: status %d", status)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	_, ts := newTestServer(t, &Options{RequestTimeout: 50 * time.Millisecond})
+	var info SessionInfo
+	request(t, "POST", ts.URL+"/sessions", "", &info)
+	var e errorResponse
+	if status := request(t, "POST", ts.URL+"/sessions/"+info.Id+"/actions/test_echo", `{"delay": 500}`, &e); status != http.StatusGatewayTimeout {
+		t.Errorf("slow action: status %d, %s", status, e.Error)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	s, ts := newTestServer(t, &Options{RequestTimeout: time.Second, IdleTimeout: time.Hour})
+	var idle, used SessionInfo
+	request(t, "POST", ts.URL+"/sessions", "", &idle)
+	request(t, "POST", ts.URL+"/sessions", "", &used)
+	s.mutex.Lock()
+	s.sessions[idle.Id].lastUsed = time.Now().Add(-2 * time.Hour)
+	s.mutex.Unlock()
+	s.expire(time.Now())
+	var list []*SessionInfo
+	if request(t, "GET", ts.URL+"/sessions", "", &list); len(list) != 1 || list[0].Id != used.Id {
+		t.Fatalf("sessions after expiry: %+v", list)
+	}
+}
+
+func TestSessionConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      browser.BrowserConfig
+		workspace string
+		har       string
+	}{
+		{"defaults", browser.BrowserConfig{}, "abc", ""},
+		{"workspace", browser.BrowserConfig{WorkspaceDir: "/srv/files"}, "/srv/files/abc", ""},
+		{"har", browser.BrowserConfig{HarPath: "/tmp/net.har"}, "abc", "/tmp/net-abc.har"},
+		{"har without extension", browser.BrowserConfig{HarPath: "logs/network"}, "abc", "logs/network-abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.base.StorageStatePath = "state.json"
+			config := sessionConfig(&tt.base, "abc")
+			if config.WorkspaceDir != tt.workspace || config.HarPath != tt.har {
+				t.Errorf("workspace %q har %q, want %q %q", config.WorkspaceDir, config.HarPath, tt.workspace, tt.har)
+			}
+			// the storage state is only read
+			if config.StorageStatePath != "state.json" {
+				t.Errorf("storage state %q", config.StorageStatePath)
+			}
+			if tt.base.WorkspaceDir == config.WorkspaceDir {
+				t.Error("the options are changed")
+			}
+		})
+	}
+}
+
+func TestSessionFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := browser.DefaultBrowserConfig()
+	config.WorkspaceDir = dir
+	config.HarPath = filepath.Join(dir, "network.har")
+	_, ts := newTestServer(t, &Options{Config: config, RequestTimeout: time.Second})
+	var first, second SessionInfo
+	request(t, "POST", ts.URL+"/sessions", "", &first)
+	request(t, "POST", ts.URL+"/sessions", "", &second)
+	if first.Workspace == second.Workspace || first.HarPath == second.HarPath {
+		t.Fatalf("sessions share files: %+v %+v", first, second)
+	}
+	if first.Workspace != filepath.Join(dir, first.Id) || first.HarPath != filepath.Join(dir, "network-"+first.Id+".har") {
+		t.Errorf("files of the session %+v", first)
+	}
+	if config.WorkspaceDir != dir || config.HarPath != filepath.Join(dir, "network.har") {
+		t.Errorf("the options are changed: %+v", config)
+	}
+}
+
+func TestToken(t *testing.T) {
+	_, ts := newTestServer(t, &Options{Token: "s3cret"})
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"s3cret", http.StatusUnauthorized},
+		{"Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", ts.URL+"/sessions", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("Authorization %q: status %d, want %d", tt.header, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+// a session closed while a request runs is closed by that request when it returns
+func TestCloseBusySession(t *testing.T) {
+	var logs syncBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	_, ts := newTestServer(t, &Options{RequestTimeout: 50 * time.Millisecond, Logger: logger})
+	var info SessionInfo
+	request(t, "POST", ts.URL+"/sessions", "", &info)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		var e errorResponse
+		request(t, "POST", ts.URL+"/sessions/"+info.Id+"/actions/test_echo", `{"delay": 300}`, &e)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if status := request(t, "DELETE", ts.URL+"/sessions/"+info.Id, "", nil); status != http.StatusAccepted {
+		t.Fatalf("close a busy session: status %d", status)
+	}
+	if strings.Contains(logs.String(), "session closed") {
+		t.Fatal("the browser is closed while the action runs")
+	}
+	<-returned
+	for deadline := time.Now().Add(2 * time.Second); !strings.Contains(logs.String(), "session closed"); {
+		if time.Now().After(deadline) {
+			t.Fatal("the session is not closed after its action returned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}